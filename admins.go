@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func bootstrapGlobalAdmins(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM global_admins").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for _, email := range strings.Split(os.Getenv("ADMINS"), ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO global_admins (email, granted_by) VALUES ($1, 'ADMINS') ON CONFLICT (email) DO NOTHING", email); err != nil {
+			return err
+		}
+		log.Println("bootstrapped global admin", email)
+	}
+	return nil
+}
+
+func handleListGlobalAdmins(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireAdmin(postgresStore{db}, w, r); !ok {
+			return
+		}
+		rows, err := db.Query("SELECT id, email, granted_by, granted_at FROM global_admins ORDER BY email")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		type admin struct {
+			ID        int64     `json:"id"`
+			Email     string    `json:"email"`
+			GrantedBy string    `json:"granted_by"`
+			GrantedAt time.Time `json:"granted_at"`
+		}
+		var admins []admin
+		for rows.Next() {
+			var a admin
+			if err := rows.Scan(&a.ID, &a.Email, &a.GrantedBy, &a.GrantedAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			admins = append(admins, a)
+		}
+		if admins == nil {
+			admins = []admin{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(admins)
+	}
+}
+
+func handleAddGlobalAdmin(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Email) == "" {
+			http.Error(w, "email is required", http.StatusBadRequest)
+			return
+		}
+		body.Email = strings.TrimSpace(body.Email)
+		var id int64
+		err := db.QueryRow("INSERT INTO global_admins (email, granted_by) VALUES ($1, $2) RETURNING id", body.Email, email).Scan(&id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{Actor: email, Role: "global_admin", Action: "global_admin.add", After: loadAuditRow(db, "global_admins", "id", id)})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "email": body.Email, "granted_by": email})
+	}
+}
+
+func handleRemoveGlobalAdmin(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		adminID, err := strconv.ParseInt(r.PathValue("adminID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid admin ID", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "global_admins", "id", adminID)
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		// Lock every admin row so two removals cannot both see the other
+		// admin and leave nobody behind.
+		rows, err := tx.Query("SELECT id FROM global_admins FOR UPDATE")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		count, found := 0, false
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			count++
+			found = found || id == adminID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "admin not found", http.StatusNotFound)
+			return
+		}
+		if count == 1 {
+			http.Error(w, "cannot remove the last admin", http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM global_admins WHERE id = $1", adminID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{Actor: email, Role: "global_admin", Action: "global_admin.remove", Before: before})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
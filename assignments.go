@@ -0,0 +1,386 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"rooms/solver"
+)
+
+type assignmentInfo struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Score     int       `json:"score"`
+	Published bool      `json:"published"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func handleListAssignments(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.Query(`
+			SELECT id, name, version, score, published, created_by, created_at
+			FROM assignments
+			WHERE trip_id = $1
+			ORDER BY name, version DESC`, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		var assignments []assignmentInfo
+		for rows.Next() {
+			var a assignmentInfo
+			if err := rows.Scan(&a.ID, &a.Name, &a.Version, &a.Score, &a.Published, &a.CreatedBy, &a.CreatedAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			assignments = append(assignments, a)
+		}
+		if assignments == nil {
+			assignments = []assignmentInfo{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assignments)
+	}
+}
+
+func handleCreateAssignment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Name  string `json:"name"`
+			Rooms []struct {
+				Room    int   `json:"room"`
+				ID      int64 `json:"id"`
+				Members []struct {
+					ID int64 `json:"id"`
+				} `json:"members"`
+			} `json:"rooms"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if body.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if len(body.Rooms) == 0 {
+			http.Error(w, "rooms are required", http.StatusBadRequest)
+			return
+		}
+		seen := map[int64]bool{}
+		seenRooms := map[int64]bool{}
+		var placements []placement
+		for _, room := range body.Rooms {
+			if seenRooms[room.ID] {
+				http.Error(w, "room "+strconv.FormatInt(room.ID, 10)+" appears more than once", http.StatusBadRequest)
+				return
+			}
+			seenRooms[room.ID] = true
+			for _, m := range room.Members {
+				if seen[m.ID] {
+					http.Error(w, "student "+strconv.FormatInt(m.ID, 10)+" appears in more than one room", http.StatusBadRequest)
+					return
+				}
+				seen[m.ID] = true
+				placements = append(placements, placement{studentID: m.ID, roomID: room.ID})
+			}
+		}
+		in, ok := loadSolveInput(db, w, tripID)
+		if !ok {
+			return
+		}
+		assignment, err := checkedAssignment(in, placements)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		score := in.problem.Score(assignment)
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var a assignmentInfo
+		err = tx.QueryRow(`
+			INSERT INTO assignments (trip_id, name, version, score, created_by)
+			SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4
+			FROM assignments WHERE trip_id = $1 AND name = $2
+			RETURNING id, name, version, score, published, created_by, created_at`,
+			tripID, body.Name, score, email).Scan(&a.ID, &a.Name, &a.Version, &a.Score, &a.Published, &a.CreatedBy, &a.CreatedAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, sid := range in.studentIDs {
+			room := in.rooms[assignment[i]]
+			if _, err := tx.Exec("INSERT INTO assignment_rooms (assignment_id, room, room_id, student_id) VALUES ($1, $2, $3, $4)",
+				a.ID, room.Number, room.ID, sid); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "assignment.create", After: a})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a)
+	}
+}
+
+func handleGetAssignment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		assignmentID, err := strconv.ParseInt(r.PathValue("assignmentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid assignment ID", http.StatusBadRequest)
+			return
+		}
+		var a assignmentInfo
+		err = db.QueryRow(`
+			SELECT id, name, version, score, published, created_by, created_at
+			FROM assignments WHERE id = $1 AND trip_id = $2`, assignmentID, tripID).Scan(&a.ID, &a.Name, &a.Version, &a.Score, &a.Published, &a.CreatedBy, &a.CreatedAt)
+		if err != nil {
+			http.Error(w, "assignment not found", http.StatusNotFound)
+			return
+		}
+		rooms, err := loadAssignmentRooms(db, a.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			assignmentInfo
+			Rooms []solutionRoom `json:"rooms"`
+		}{a, rooms})
+	}
+}
+
+type placement struct {
+	studentID, roomID int64
+}
+
+// checkedAssignment turns placements into a solver assignment for in and
+// checks it against the trip's capacities, pins, eligibility rules and hard
+// constraints, so saved and published rooming lists are always valid.
+func checkedAssignment(in *solveInput, placements []placement) ([]int, error) {
+	roomIdx := map[int64]int{}
+	for i, room := range in.rooms {
+		roomIdx[room.ID] = i
+	}
+	studentIdx := map[int64]int{}
+	assignment := make([]int, len(in.studentIDs))
+	for i, id := range in.studentIDs {
+		studentIdx[id] = i
+		assignment[i] = -1
+	}
+	for _, pl := range placements {
+		i, ok := studentIdx[pl.studentID]
+		if !ok {
+			return nil, fmt.Errorf("student %d is not on this trip", pl.studentID)
+		}
+		room, ok := roomIdx[pl.roomID]
+		if !ok {
+			return nil, fmt.Errorf("room %d is not in this trip", pl.roomID)
+		}
+		assignment[i] = room
+	}
+	err := in.problem.Check(assignment)
+	var ce *solver.CheckError
+	if !errors.As(err, &ce) {
+		return assignment, err
+	}
+	names := make([]string, len(ce.Students))
+	for j, i := range ce.Students {
+		names[j] = in.studentName[in.studentIDs[i]]
+	}
+	msg := ce.Reason
+	if ce.Room >= 0 {
+		room := in.rooms[ce.Room]
+		label := room.Name
+		if label == "" {
+			label = strconv.Itoa(room.Number)
+		}
+		msg += " (room " + label + ")"
+	}
+	return nil, errors.New(msg + ": " + strings.Join(names, ", "))
+}
+
+func loadAssignmentRooms(db *sql.DB, assignmentID int64) ([]solutionRoom, error) {
+	rows, err := db.Query(`
+		SELECT ar.room, COALESCE(r.id, 0), COALESCE(r.room_group_id, 0), COALESCE(r.name, ''), COALESCE(r.floor, ''), COALESCE(r.building, ''), COALESCE(r.capacity, 0), s.id, s.name
+		FROM assignment_rooms ar
+		JOIN students s ON s.id = ar.student_id
+		LEFT JOIN rooms r ON r.id = ar.room_id
+		WHERE ar.assignment_id = $1
+		ORDER BY ar.room, s.name`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := []solutionRoom{}
+	for rows.Next() {
+		var ri roomInfo
+		var m roomMember
+		if err := rows.Scan(&ri.Number, &ri.ID, &ri.RoomGroupID, &ri.Name, &ri.Floor, &ri.Building, &ri.Capacity, &m.ID, &m.Name); err != nil {
+			return nil, err
+		}
+		if len(rooms) == 0 || rooms[len(rooms)-1].Number != ri.Number {
+			rooms = append(rooms, solutionRoom{roomInfo: ri})
+		}
+		rooms[len(rooms)-1].Members = append(rooms[len(rooms)-1].Members, m)
+	}
+	return rooms, rows.Err()
+}
+
+func handlePublishAssignment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		assignmentID, err := strconv.ParseInt(r.PathValue("assignmentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid assignment ID", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM assignments WHERE id = $1 AND trip_id = $2)", assignmentID, tripID).Scan(&exists)
+		if !exists {
+			http.Error(w, "assignment not found", http.StatusNotFound)
+			return
+		}
+		rooms, err := loadAssignmentRooms(db, assignmentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var placements []placement
+		for _, room := range rooms {
+			for _, m := range room.Members {
+				placements = append(placements, placement{studentID: m.ID, roomID: room.ID})
+			}
+		}
+		in, ok := loadSolveInput(db, w, tripID)
+		if !ok {
+			return
+		}
+		if _, err := checkedAssignment(in, placements); err != nil {
+			http.Error(w, "assignment no longer fits the trip: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE assignments SET published = FALSE WHERE trip_id = $1 AND published", tripID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result, err := tx.Exec("UPDATE assignments SET published = TRUE WHERE id = $1 AND trip_id = $2", assignmentID, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "assignment not found", http.StatusNotFound)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "assignment.publish", After: loadAuditRow(db, "assignments", "id", assignmentID)})
+		if _, err := queueTripEmails(db, tripID, "published", []string{"student", "parent"}, strconv.FormatInt(assignmentID, 10), nil, false); err != nil {
+			log.Printf("failed to queue publish emails for trip %d: %v", tripID, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleMyRoom shows members the published room of each of their students.
+// Roommates are listed by name only, and no other room is ever included.
+func handleMyRoom(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, _, studentIDs, ok := requireTripMember(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		type myRoom struct {
+			StudentID int64    `json:"student_id"`
+			Room      int      `json:"room"`
+			Name      string   `json:"name"`
+			Building  string   `json:"building"`
+			Floor     string   `json:"floor"`
+			Roommates []string `json:"roommates"`
+		}
+		rooms := []myRoom{}
+		var published bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM assignments WHERE trip_id = $1 AND published)", tripID).Scan(&published); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if published && len(studentIDs) > 0 {
+			rows, err := db.Query(`
+				SELECT ar.student_id, ar.room, COALESCE(r.name, ''), COALESCE(r.building, ''), COALESCE(r.floor, ''),
+					COALESCE((
+						SELECT array_agg(s.name ORDER BY s.name)
+						FROM assignment_rooms o
+						JOIN students s ON s.id = o.student_id
+						WHERE o.assignment_id = ar.assignment_id AND o.room = ar.room AND o.student_id != ar.student_id
+					), '{}')
+				FROM assignments a
+				JOIN assignment_rooms ar ON ar.assignment_id = a.id
+				LEFT JOIN rooms r ON r.id = ar.room_id
+				WHERE a.trip_id = $1 AND a.published AND ar.student_id = ANY($2)`, tripID, pq.Array(studentIDs))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var m myRoom
+				if err := rows.Scan(&m.StudentID, &m.Room, &m.Name, &m.Building, &m.Floor, pq.Array(&m.Roommates)); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if m.Roommates == nil {
+					m.Roommates = []string{}
+				}
+				rooms = append(rooms, m)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"published": published, "rooms": rooms})
+	}
+}
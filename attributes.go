@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type roomRule struct {
+	ID          int64  `json:"id"`
+	RoomGroupID *int64 `json:"room_group_id"`
+	RoomID      *int64 `json:"room_id"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+}
+
+func normalizeAttributeKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+func handleSetStudentAttribute(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		studentID, err := strconv.ParseInt(r.PathValue("studentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid student ID", http.StatusBadRequest)
+			return
+		}
+		key := normalizeAttributeKey(r.PathValue("key"))
+		var body struct {
+			Value string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || key == "" || strings.TrimSpace(body.Value) == "" {
+			http.Error(w, "key and value are required", http.StatusBadRequest)
+			return
+		}
+		var before *string
+		db.QueryRow("SELECT value FROM student_attributes WHERE student_id = $1 AND key = $2", studentID, key).Scan(&before)
+		result, err := db.Exec(`
+			INSERT INTO student_attributes (student_id, key, value)
+			SELECT id, $2, $3 FROM students WHERE id = $1 AND trip_id = $4
+			ON CONFLICT (student_id, key) DO UPDATE SET value = EXCLUDED.value`,
+			studentID, key, strings.TrimSpace(body.Value), tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "student not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "attribute.set", StudentIDs: []int64{studentID},
+			Before: map[string]any{"key": key, "value": before}, After: map[string]any{"key": key, "value": strings.TrimSpace(body.Value)}})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleDeleteStudentAttribute(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		studentID, err := strconv.ParseInt(r.PathValue("studentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid student ID", http.StatusBadRequest)
+			return
+		}
+		key := normalizeAttributeKey(r.PathValue("key"))
+		var value string
+		err = db.QueryRow(`
+			DELETE FROM student_attributes
+			WHERE student_id = $1 AND key = $2 AND student_id IN (SELECT id FROM students WHERE trip_id = $3)
+			RETURNING value`,
+			studentID, key, tripID).Scan(&value)
+		if err == sql.ErrNoRows {
+			http.Error(w, "attribute not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "attribute.delete", StudentIDs: []int64{studentID},
+			Before: map[string]any{"key": key, "value": value}})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func loadRoomRules(db *sql.DB, tripID int64) ([]roomRule, error) {
+	rows, err := db.Query(`
+		SELECT rr.id, rr.room_group_id, rr.room_id, rr.key, rr.value
+		FROM room_rules rr
+		LEFT JOIN rooms r ON r.id = rr.room_id
+		JOIN room_groups rg ON rg.id = COALESCE(rr.room_group_id, r.room_group_id)
+		WHERE rg.trip_id = $1
+		ORDER BY rr.key, rr.value, rr.id`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := []roomRule{}
+	for rows.Next() {
+		var rule roomRule
+		if err := rows.Scan(&rule.ID, &rule.RoomGroupID, &rule.RoomID, &rule.Key, &rule.Value); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func handleListRoomRules(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rules, err := loadRoomRules(db, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+func handleCreateRoomRule(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			RoomGroupID *int64 `json:"room_group_id"`
+			RoomID      *int64 `json:"room_id"`
+			Key         string `json:"key"`
+			Value       string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		body.Key = normalizeAttributeKey(body.Key)
+		body.Value = strings.TrimSpace(body.Value)
+		if body.Key == "" || body.Value == "" {
+			http.Error(w, "key and value are required", http.StatusBadRequest)
+			return
+		}
+		if (body.RoomGroupID == nil) == (body.RoomID == nil) {
+			http.Error(w, "exactly one of room_group_id and room_id is required", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if body.RoomGroupID != nil {
+			db.QueryRow("SELECT EXISTS(SELECT 1 FROM room_groups WHERE id = $1 AND trip_id = $2)", *body.RoomGroupID, tripID).Scan(&exists)
+		} else {
+			db.QueryRow("SELECT EXISTS(SELECT 1 FROM rooms r JOIN room_groups rg ON rg.id = r.room_group_id WHERE r.id = $1 AND rg.trip_id = $2)", *body.RoomID, tripID).Scan(&exists)
+		}
+		if !exists {
+			http.Error(w, "room not found", http.StatusBadRequest)
+			return
+		}
+		rule := roomRule{RoomGroupID: body.RoomGroupID, RoomID: body.RoomID, Key: body.Key, Value: body.Value}
+		err := db.QueryRow("INSERT INTO room_rules (room_group_id, room_id, key, value) VALUES ($1, $2, $3, $4) RETURNING id",
+			body.RoomGroupID, body.RoomID, body.Key, body.Value).Scan(&rule.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "room_rule.create", After: rule})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+func handleDeleteRoomRule(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		ruleID, err := strconv.ParseInt(r.PathValue("ruleID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid rule ID", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "room_rules", "id", ruleID)
+		result, err := db.Exec(`
+			DELETE FROM room_rules rr
+			USING room_groups rg
+			WHERE rr.id = $1 AND rg.trip_id = $2
+			AND rg.id = COALESCE(rr.room_group_id, (SELECT room_group_id FROM rooms WHERE id = rr.room_id))`, ruleID, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "rule not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "room_rule.delete", Before: before})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func loadEligibility(db *sql.DB, tripID int64, studentIDs []int64, rooms []roomInfo) ([][]bool, error) {
+	rules, err := loadRoomRules(db, tripID)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	roomRules := make([]map[string][]string, len(rooms))
+	for i, room := range rooms {
+		roomRules[i] = map[string][]string{}
+		for _, rule := range rules {
+			if (rule.RoomGroupID != nil && *rule.RoomGroupID == room.RoomGroupID) || (rule.RoomID != nil && *rule.RoomID == room.ID) {
+				roomRules[i][rule.Key] = append(roomRules[i][rule.Key], rule.Value)
+			}
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT sa.student_id, sa.key, sa.value
+		FROM student_attributes sa
+		JOIN students s ON s.id = sa.student_id
+		WHERE s.trip_id = $1`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attrs := map[int64]map[string]string{}
+	for rows.Next() {
+		var sid int64
+		var key, value string
+		if err := rows.Scan(&sid, &key, &value); err != nil {
+			return nil, err
+		}
+		if attrs[sid] == nil {
+			attrs[sid] = map[string]string{}
+		}
+		attrs[sid][key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	eligible := make([][]bool, len(studentIDs))
+	for i, sid := range studentIDs {
+		eligible[i] = make([]bool, len(rooms))
+		for room, byKey := range roomRules {
+			eligible[i][room] = true
+			for key, values := range byKey {
+				value, ok := attrs[sid][key]
+				if !ok || !containsFold(values, value) {
+					eligible[i][room] = false
+					break
+				}
+			}
+		}
+	}
+	return eligible, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type auditEntry struct {
+	TripID     int64
+	Actor      string
+	Role       string
+	Action     string
+	StudentIDs []int64
+	Before     any
+	After      any
+}
+
+type auditRow map[string]any
+
+func loadAuditRow(db *sql.DB, table, column string, value any) auditRow {
+	var raw []byte
+	if err := db.QueryRow("SELECT to_jsonb(t) FROM "+table+" t WHERE t."+column+" = $1", value).Scan(&raw); err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var row auditRow
+	if dec.Decode(&row) != nil {
+		return nil
+	}
+	return row
+}
+
+func (r auditRow) int64(key string) int64 {
+	n, _ := r[key].(json.Number)
+	v, _ := n.Int64()
+	return v
+}
+
+func auditJSON(v any) []byte {
+	if v == nil {
+		return nil
+	}
+	if row, ok := v.(auditRow); ok && row == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func recordAudit(db *sql.DB, e auditEntry) {
+	var tripID *int64
+	if e.TripID != 0 {
+		tripID = &e.TripID
+	}
+	if e.StudentIDs == nil {
+		e.StudentIDs = []int64{}
+	}
+	_, err := db.Exec(`
+		INSERT INTO audit_log (trip_id, actor, role, action, student_ids, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		tripID, e.Actor, e.Role, e.Action, pq.Array(e.StudentIDs), auditJSON(e.Before), auditJSON(e.After))
+	if err != nil {
+		log.Printf("failed to record audit entry %s by %s: %v", e.Action, e.Actor, err)
+	}
+}
+
+func writeAuditLog(w http.ResponseWriter, r *http.Request, db *sql.DB, tripID int64) {
+	q := r.URL.Query()
+	where := "TRUE"
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if tripID != 0 {
+		where += " AND trip_id = " + arg(tripID)
+	}
+	if v := q.Get("student_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid student_id", http.StatusBadRequest)
+			return
+		}
+		where += " AND " + arg(id) + " = ANY(student_ids)"
+	}
+	if v := q.Get("actor"); v != "" {
+		where += " AND lower(actor) = lower(" + arg(v) + ")"
+	}
+	for _, bound := range []struct{ param, op string }{{"since", ">="}, {"until", "<"}} {
+		if v := q.Get(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+bound.param+", expected RFC 3339", http.StatusBadRequest)
+				return
+			}
+			where += " AND created_at " + bound.op + " " + arg(t)
+		}
+	}
+	limit := 200
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.Query(`
+		SELECT id, trip_id, actor, role, action, student_ids, before, after, created_at
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT `+strconv.Itoa(limit), args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type entry struct {
+		ID         int64           `json:"id"`
+		TripID     *int64          `json:"trip_id"`
+		Actor      string          `json:"actor"`
+		Role       string          `json:"role"`
+		Action     string          `json:"action"`
+		StudentIDs []int64         `json:"student_ids"`
+		Before     json.RawMessage `json:"before"`
+		After      json.RawMessage `json:"after"`
+		CreatedAt  time.Time       `json:"created_at"`
+	}
+	entries := []entry{}
+	for rows.Next() {
+		var e entry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.TripID, &e.Actor, &e.Role, &e.Action, pq.Array(&e.StudentIDs), &before, &after, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before != nil {
+			e.Before = before
+		}
+		if after != nil {
+			e.After = after
+		}
+		entries = append(entries, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func handleTripAuditLog(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		writeAuditLog(w, r, db, tripID)
+	}
+}
+
+func handleAuditLog(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireAdmin(postgresStore{db}, w, r); !ok {
+			return
+		}
+		var tripID int64
+		if v := r.URL.Query().Get("trip_id"); v != "" {
+			var err error
+			if tripID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, "invalid trip_id", http.StatusBadRequest)
+				return
+			}
+		}
+		writeAuditLog(w, r, db, tripID)
+	}
+}
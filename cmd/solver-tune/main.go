@@ -1,9 +1,12 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"maps"
 	"math/rand"
 	"os"
 	"slices"
@@ -23,6 +26,12 @@ type roomGroupData struct {
 type tripData struct {
 	PreferNotMultiple int             `json:"prefer_not_multiple"`
 	NoPreferCost      int             `json:"no_prefer_cost"`
+	Objective         string          `json:"objective"`
+	FairnessWeight    int             `json:"fairness_weight"`
+	SingletonCost     int             `json:"singleton_cost"`
+	MinOccupancy      int             `json:"min_occupancy"`
+	UnderfillCost     int             `json:"underfill_cost"`
+	ImbalanceCost     int             `json:"imbalance_cost"`
 	RoomGroups        []roomGroupData `json:"room_groups"`
 }
 
@@ -36,6 +45,7 @@ type constraintsData struct {
 		StudentAID int64  `json:"student_a_id"`
 		StudentBID int64  `json:"student_b_id"`
 		Kind       string `json:"kind"`
+		Weight     int    `json:"weight"`
 	} `json:"overalls"`
 }
 
@@ -64,9 +74,11 @@ func normalizeKey(a []int) string {
 }
 
 type runResult struct {
-	score     int
-	solutions [][]int
-	elapsed   time.Duration
+	score         int
+	solutions     [][]int
+	studentScores []int
+	elapsed       time.Duration
+	stats         solver.Stats
 }
 
 func printStats(label string, results []runResult, runs int) {
@@ -87,6 +99,17 @@ func printStats(label string, results []runResult, runs int) {
 
 	fmt.Printf("--- %s ---\n", label)
 	fmt.Printf("  avg time: %v\n", totalTime/time.Duration(runs))
+	var iterations, bestIteration int
+	var bestAfter time.Duration
+	for _, r := range results {
+		iterations += r.stats.Iterations
+		bestIteration += r.stats.BestIteration
+		bestAfter += r.stats.BestFoundAfter
+	}
+	if iterations > 0 {
+		fmt.Printf("  avg iterations: %d, best last improved at iteration %d after %v\n",
+			iterations/len(results), bestIteration/len(results), (bestAfter / time.Duration(len(results))).Round(time.Millisecond))
+	}
 
 	var scoreList []struct {
 		score int
@@ -105,6 +128,25 @@ func printStats(label string, results []runResult, runs int) {
 		fmt.Printf("    score %d: %d/%d runs (%.0f%%)\n", sc.score, sc.count, runs, float64(sc.count)/float64(runs)*100)
 	}
 
+	var worstTotal int
+	studentHist := map[int]int{}
+	var studentTotal int
+	for _, r := range results {
+		worstTotal += slices.Min(r.studentScores)
+		for _, sc := range r.studentScores {
+			studentHist[sc]++
+			studentTotal++
+		}
+	}
+	if len(results) > 0 {
+		fmt.Printf("  avg worst-off student: %.1f\n", float64(worstTotal)/float64(len(results)))
+		fmt.Printf("  per-student score distribution:\n")
+		levels := slices.Sorted(maps.Keys(studentHist))
+		for _, sc := range levels {
+			fmt.Printf("    %4d: %5.1f%%\n", sc, float64(studentHist[sc])/float64(studentTotal)*100)
+		}
+	}
+
 	fmt.Printf("  unique solutions seen: %d\n", len(solutionSets))
 	fmt.Printf("  avg solutions per run: %.1f\n", float64(totalSolutions)/float64(runs))
 
@@ -141,6 +183,45 @@ func printStats(label string, results []runResult, runs int) {
 	fmt.Println()
 }
 
+func printExplanation(problem solver.Problem, students []studentData, assignment []int) {
+	ex := problem.Explain(assignment)
+	names := func(idxs []int) string {
+		var parts []string
+		for _, i := range idxs {
+			parts = append(parts, students[i].Name)
+		}
+		return strings.Join(parts, ", ")
+	}
+	fmt.Printf("=== best solution explained (score %d) ===\n", ex.Score)
+	for _, room := range ex.Rooms {
+		if len(room.Students) == 0 {
+			continue
+		}
+		fmt.Printf("  room %d (score %d", room.Room+1, room.Score)
+		if room.FillPenalty > 0 {
+			fmt.Printf(", fill penalty %d", room.FillPenalty)
+		}
+		fmt.Println(")")
+		for _, i := range room.Students {
+			st := ex.Students[i]
+			fmt.Printf("    %s: %d", students[i].Name, st.Score)
+			if len(st.PrefersSatisfied) > 0 {
+				fmt.Printf("; with %s", names(st.PrefersSatisfied))
+			}
+			if len(st.PrefersUnsatisfied) > 0 {
+				fmt.Printf("; missed %s", names(st.PrefersUnsatisfied))
+			}
+			if len(st.PreferNotsViolated) > 0 {
+				fmt.Printf("; unwanted %s", names(st.PreferNotsViolated))
+			}
+			if st.NoPreferPenalty {
+				fmt.Print("; no prefers satisfied")
+			}
+			fmt.Println()
+		}
+	}
+}
+
 func main() {
 	dir := flag.String("dir", "tmp", "directory with trip/students/constraints JSON files")
 	runs := flag.Int("runs", 20, "number of solver runs per parameter set")
@@ -148,6 +229,11 @@ func main() {
 	numPerturb := flag.String("perturb", "1500", "comma-separated perturbation counts")
 	perturbMin := flag.Int("pmin", 3, "perturbation min groups")
 	perturbMax := flag.Int("pmax", 8, "perturbation max groups")
+	numWorkers := flag.String("workers", "1", "comma-separated worker goroutine counts")
+	budget := flag.Duration("time", 0, "time budget per run; the fast strategy perturbs until it runs out instead of -perturb times")
+	explain := flag.Bool("explain", false, "print a per-room, per-student breakdown of the best solution")
+	objectiveList := flag.String("objective", "", "comma-separated objectives to compare (sum, maxmin, hybrid); defaults to the trip's")
+	strategyList := flag.String("strategy", "fast", "comma-separated strategies to compare ("+strings.Join(solver.Strategies(), ", ")+")")
 	flag.Parse()
 
 	tripBytes, err := os.ReadFile(*dir + "/1")
@@ -191,6 +277,7 @@ func main() {
 			StudentA: ai,
 			StudentB: bi,
 			Kind:     o.Kind,
+			Weight:   o.Weight,
 		})
 	}
 
@@ -205,38 +292,113 @@ func main() {
 		os.Exit(1)
 	}
 
+	problem := solver.Problem{
+		N:                 n,
+		RoomSizes:         roomSizes,
+		PreferNotMultiple: trip.PreferNotMultiple,
+		NoPreferCost:      trip.NoPreferCost,
+		Constraints:       constraints,
+		FairnessWeight:    trip.FairnessWeight,
+		SingletonCost:     trip.SingletonCost,
+		MinOccupancy:      trip.MinOccupancy,
+		UnderfillCost:     trip.UnderfillCost,
+		ImbalanceCost:     trip.ImbalanceCost,
+	}
+	objectives := []string{cmp.Or(trip.Objective, solver.ObjectiveSum)}
+	if *objectiveList != "" {
+		objectives = strings.Split(*objectiveList, ",")
+	}
+
 	fmt.Printf("Students: %d, Room sizes: %v, Constraints: %d\n", n, roomSizes, len(constraints))
 	fmt.Printf("Prefer Not multiple: %d, No Prefer cost: %d\n", trip.PreferNotMultiple, trip.NoPreferCost)
 	fmt.Printf("Runs per config: %d\n\n", *runs)
 
 	randomCounts := parseIntList(*numRandom)
 	perturbCounts := parseIntList(*numPerturb)
-	for _, nr := range randomCounts {
-		for _, np := range perturbCounts {
-			params := solver.Params{
-				NumRandom:  nr,
-				NumPerturb: np,
-				PerturbMin: *perturbMin,
-				PerturbMax: *perturbMax,
+	workerCounts := parseIntList(*numWorkers)
+	for _, objective := range objectives {
+		problem.Objective = strings.TrimSpace(objective)
+		if !slices.Contains(solver.Objectives, problem.Objective) {
+			fmt.Fprintf(os.Stderr, "unknown objective %q\n", problem.Objective)
+			os.Exit(1)
+		}
+		var best *solver.Solution
+		for _, strategy := range strings.Split(*strategyList, ",") {
+			strategy = strings.TrimSpace(strategy)
+			configs := []solver.Params{solver.DefaultParams}
+			if strategy == "fast" {
+				configs = nil
+				for _, nr := range randomCounts {
+					for _, np := range perturbCounts {
+						for _, nw := range workerCounts {
+							configs = append(configs, solver.Params{
+								NumRandom:  nr,
+								NumPerturb: np,
+								PerturbMin: *perturbMin,
+								PerturbMax: *perturbMax,
+								Workers:    nw,
+								Budget:     *budget,
+							})
+						}
+					}
+				}
 			}
-			var results []runResult
-			for run := range *runs {
-				rng := rand.New(rand.NewSource(int64(run * 31337)))
-				start := time.Now()
-				sols := solver.SolveFast(n, roomSizes, trip.PreferNotMultiple, trip.NoPreferCost, constraints, params, rng)
-				elapsed := time.Since(start)
-				if len(sols) > 0 {
-					var assignments [][]int
-					for _, s := range sols {
-						assignments = append(assignments, s.Assignment)
+			for _, params := range configs {
+				var results []runResult
+				for run := range *runs {
+					rng := rand.New(rand.NewSource(int64(run * 31337)))
+					s, err := solver.New(strategy, solver.Options{Params: params, Rand: rng})
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						os.Exit(1)
+					}
+					res, elapsed, err := solveOnce(s, problem, *budget)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%s: %v\n", strategy, err)
+						break
+					}
+					sols := res.Solutions
+					if len(sols) > 0 {
+						if best == nil || sols[0].Score > best.Score {
+							best = &sols[0]
+						}
+						var assignments [][]int
+						for _, s := range sols {
+							assignments = append(assignments, s.Assignment)
+						}
+						var studentScores []int
+						for _, st := range problem.Explain(sols[0].Assignment).Students {
+							studentScores = append(studentScores, st.Score)
+						}
+						results = append(results, runResult{sols[0].Score, assignments, studentScores, elapsed, res.Stats})
 					}
-					results = append(results, runResult{sols[0].Score, assignments, elapsed})
 				}
+				label := fmt.Sprintf("strategy=%s objective=%s", strategy, problem.Objective)
+				if strategy == "fast" {
+					label += fmt.Sprintf(" random=%d perturb=%d pmin=%d pmax=%d workers=%d", params.NumRandom, params.NumPerturb, params.PerturbMin, params.PerturbMax, params.Workers)
+				}
+				if *budget > 0 {
+					label += fmt.Sprintf(" time=%v", *budget)
+				}
+				printStats(label, results, *runs)
 			}
-			label := fmt.Sprintf("random=%d perturb=%d pmin=%d pmax=%d", nr, np, *perturbMin, *perturbMax)
-			printStats(label, results, *runs)
 		}
+		if *explain && best != nil {
+			printExplanation(problem, students, best.Assignment)
+		}
+	}
+}
+
+func solveOnce(s solver.Solver, problem solver.Problem, budget time.Duration) (solver.Result, time.Duration, error) {
+	ctx := context.Background()
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
 	}
+	start := time.Now()
+	res, err := s.Solve(ctx, problem, nil)
+	return res, time.Since(start), err
 }
 
 func parseIntList(s string) []int {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"rooms/solver"
+)
+
+type solveDiagnostics struct {
+	Feasible        bool       `json:"feasible"`
+	Students        int        `json:"students"`
+	Capacity        int        `json:"capacity"`
+	LargestRoom     int        `json:"largest_room"`
+	HardConflict    bool       `json:"hard_conflict"`
+	OversizedGroups [][]string `json:"oversized_groups"`
+	StrandedGroups  [][]string `json:"stranded_groups"`
+	ApartCliques    [][]string `json:"apart_cliques"`
+	Placement       string     `json:"placement"`
+	Problems        []string   `json:"problems"`
+}
+
+func diagnoseSolveInput(in *solveInput) solveDiagnostics {
+	d := solver.Diagnose(in.problem)
+	names := func(groups [][]int) [][]string {
+		out := [][]string{}
+		for _, g := range groups {
+			var list []string
+			for _, i := range g {
+				list = append(list, in.studentName[in.studentIDs[i]])
+			}
+			out = append(out, list)
+		}
+		return out
+	}
+	sd := solveDiagnostics{
+		Feasible:        d.Feasible(),
+		Students:        d.Students,
+		Capacity:        d.Capacity,
+		LargestRoom:     d.LargestRoom,
+		HardConflict:    d.HardConflict,
+		OversizedGroups: names(d.OversizedGroups),
+		StrandedGroups:  names(d.StrandedGroups),
+		ApartCliques:    names(d.ApartCliques),
+		Placement:       d.Placement,
+		Problems:        []string{},
+	}
+
+	if d.HardConflict {
+		sd.Problems = append(sd.Problems, "hard constraints contradict each other or the room rules and pins")
+	}
+	if d.Students > d.Capacity {
+		sd.Problems = append(sd.Problems, fmt.Sprintf("%d students but only %d beds", d.Students, d.Capacity))
+	}
+	for _, g := range sd.OversizedGroups {
+		sd.Problems = append(sd.Problems, fmt.Sprintf("must-together group of %d is larger than every room it may use: %s", len(g), strings.Join(g, ", ")))
+	}
+	for _, g := range sd.StrandedGroups {
+		sd.Problems = append(sd.Problems, "no room may hold must-together group: "+strings.Join(g, ", "))
+	}
+	for _, g := range sd.ApartCliques {
+		sd.Problems = append(sd.Problems, fmt.Sprintf("must_not constraints need more than %d rooms: %s", len(in.rooms), strings.Join(g, ", ")))
+	}
+	if len(sd.Problems) == 0 && d.Placement == solver.PlacementImpossible {
+		sd.Problems = append(sd.Problems, "no way to fit every group into the rooms while keeping must_not pairs apart")
+	}
+	return sd
+}
+
+// requireFeasible writes a 422 with the diagnostics and returns false when
+// the trip cannot be solved as configured.
+func requireFeasible(w http.ResponseWriter, in *solveInput) bool {
+	d := diagnoseSolveInput(in)
+	if d.Feasible {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":       "trip cannot be solved: " + strings.Join(d.Problems, "; "),
+		"diagnostics": d,
+	})
+	return false
+}
+
+func handleSolveDiagnostics(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		in, ok := loadSolveInput(db, w, tripID)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diagnoseSolveInput(in))
+	}
+}
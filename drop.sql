@@ -1,8 +0,0 @@
-DROP TABLE IF EXISTS roommate_constraints;
-DROP TABLE IF EXISTS parents;
-DROP TABLE IF EXISTS students;
-DROP TABLE IF EXISTS room_groups;
-DROP TABLE IF EXISTS trip_admins;
-DROP TABLE IF EXISTS trips;
-DROP TYPE IF EXISTS constraint_level;
-DROP TYPE IF EXISTS constraint_kind;
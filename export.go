@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type exportMember struct {
+	Name    string
+	Email   string
+	Parents []string
+}
+
+type exportRoom struct {
+	Label    string
+	Place    string
+	Building string
+	Floor    string
+	Capacity int
+	Members  []exportMember
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func buildExport(db *sql.DB, tripID int64, rooms []solutionRoom) ([]exportRoom, error) {
+	var ids []int64
+	for _, room := range rooms {
+		for _, m := range room.Members {
+			ids = append(ids, m.ID)
+		}
+	}
+	rows, err := db.Query(`
+		SELECT s.id, s.name, s.email, COALESCE(array_agg(p.email ORDER BY p.email) FILTER (WHERE p.id IS NOT NULL), '{}')
+		FROM students s
+		LEFT JOIN parents p ON p.student_id = s.id
+		WHERE s.trip_id = $1 AND s.id = ANY($2)
+		GROUP BY s.id, s.name, s.email`, tripID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	students := map[int64]exportMember{}
+	for rows.Next() {
+		var id int64
+		var m exportMember
+		if err := rows.Scan(&id, &m.Name, &m.Email, pq.Array(&m.Parents)); err != nil {
+			return nil, err
+		}
+		students[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sorted := slices.Clone(rooms)
+	slices.SortStableFunc(sorted, func(a, b solutionRoom) int { return a.Number - b.Number })
+	var out []exportRoom
+	for _, room := range sorted {
+		er := exportRoom{
+			Label:    room.Name,
+			Building: room.Building,
+			Floor:    room.Floor,
+			Capacity: room.Capacity,
+		}
+		if er.Label == "" {
+			er.Label = "Room " + strconv.Itoa(room.Number)
+		}
+		var place []string
+		if room.Building != "" {
+			place = append(place, room.Building)
+		}
+		if room.Floor != "" {
+			place = append(place, "Floor "+room.Floor)
+		}
+		er.Place = strings.Join(place, ", ")
+		for _, m := range room.Members {
+			s, ok := students[m.ID]
+			if !ok {
+				return nil, fmt.Errorf("student %d not found", m.ID)
+			}
+			er.Members = append(er.Members, s)
+		}
+		slices.SortFunc(er.Members, func(a, b exportMember) int { return strings.Compare(a.Name, b.Name) })
+		out = append(out, er)
+	}
+	return out, nil
+}
+
+func writeExport(w http.ResponseWriter, r *http.Request, db *sql.DB, tripID int64, title string, rooms []solutionRoom) {
+	format := r.URL.Query().Get("format")
+	contacts := r.URL.Query().Get("contacts") == "1"
+	if format != "csv" && format != "html" && format != "pdf" {
+		http.Error(w, "format must be csv, html or pdf", http.StatusBadRequest)
+		return
+	}
+	var tripName string
+	if err := db.QueryRow("SELECT name FROM trips WHERE id = $1", tripID).Scan(&tripName); err != nil {
+		http.Error(w, "trip not found", http.StatusNotFound)
+		return
+	}
+	exported, err := buildExport(db, tripID, rooms)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := strings.Trim(unsafeFilename.ReplaceAllString(tripName+" "+title, "-"), "-")
+	if filename == "" {
+		filename = "rooms"
+	}
+	if format != "html" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+"."+format+`"`)
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		header := []string{"Room", "Building", "Floor", "Capacity", "Student"}
+		if contacts {
+			header = append(header, "Student Email", "Parent Emails")
+		}
+		cw.Write(header)
+		for _, room := range exported {
+			for _, m := range room.Members {
+				record := []string{room.Label, room.Building, room.Floor, strconv.Itoa(room.Capacity), m.Name}
+				if contacts {
+					record = append(record, m.Email, strings.Join(m.Parents, "; "))
+				}
+				for i, cell := range record {
+					record[i] = csvSafe(cell)
+				}
+				cw.Write(record)
+			}
+		}
+		cw.Flush()
+	case "html":
+		w.Header().Set("Content-Type", "text/html")
+		htmlTemplates.ExecuteTemplate(w, "export.html", map[string]any{
+			"trip":     tripName,
+			"title":    title,
+			"rooms":    exported,
+			"contacts": contacts,
+		})
+	case "pdf":
+		lines := []pdfLine{{text: tripName, size: 16, bold: true}}
+		if title != "" {
+			lines = append(lines, pdfLine{text: title, size: 11})
+		}
+		for _, room := range exported {
+			heading := room.Label
+			if room.Place != "" {
+				heading += " - " + room.Place
+			}
+			heading += " (" + strconv.Itoa(len(room.Members)) + "/" + strconv.Itoa(room.Capacity) + ")"
+			lines = append(lines, pdfLine{text: "", size: 6}, pdfLine{text: heading, size: 12, bold: true})
+			for _, m := range room.Members {
+				text := m.Name
+				if contacts {
+					text += " - " + m.Email
+					if len(m.Parents) > 0 {
+						text += " - parents: " + strings.Join(m.Parents, ", ")
+					}
+				}
+				lines = append(lines, pdfLine{text: text, size: 10, indent: 12})
+			}
+		}
+		for _, line := range lines {
+			if !pdfEncodable(line.text) {
+				w.Header().Del("Content-Disposition")
+				http.Error(w, "the PDF export cannot show "+strconv.Quote(line.text)+"; use the HTML export instead", http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(renderPDF(lines))
+	}
+}
+
+// csvSafe stops spreadsheets from running a cell as a formula by prefixing
+// cells that start with a formula character with a quote.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func handleExportSolution(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body solutionResult
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Rooms) == 0 {
+			http.Error(w, "rooms are required", http.StatusBadRequest)
+			return
+		}
+		writeExport(w, r, db, tripID, "", body.Rooms)
+	}
+}
+
+func handleExportAssignment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		assignmentID, err := strconv.ParseInt(r.PathValue("assignmentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid assignment ID", http.StatusBadRequest)
+			return
+		}
+		var name string
+		var version int
+		if err := db.QueryRow("SELECT name, version FROM assignments WHERE id = $1 AND trip_id = $2", assignmentID, tripID).Scan(&name, &version); err != nil {
+			http.Error(w, "assignment not found", http.StatusNotFound)
+			return
+		}
+		rooms, err := loadAssignmentRooms(db, assignmentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeExport(w, r, db, tripID, name+" v"+strconv.Itoa(version), rooms)
+	}
+}
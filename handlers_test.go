@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	store *memoryStore
+	mux   *http.ServeMux
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := newMemoryStore()
+	store.globalAdmins["admin@example.com"] = true
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/logout", handleLogout(store))
+	mux.HandleFunc("POST /auth/logout-all", handleLogoutAll(store))
+	mux.HandleFunc("GET /api/admin/check", handleAdminCheck(store))
+	mux.HandleFunc("POST /api/admin/sessions/revoke", handleRevokeUserSessions(store))
+	mux.HandleFunc("GET /api/trips", handleListTrips(store))
+	mux.HandleFunc("POST /api/trips", handleCreateTrip(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}", handleDeleteTrip(store))
+	mux.HandleFunc("POST /api/trips/{tripID}/admins", handleAddTripAdmin(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}/admins/{adminID}", handleRemoveTripAdmin(store))
+	mux.HandleFunc("GET /api/trips/{tripID}/me", handleTripMe(store))
+	mux.HandleFunc("GET /api/trips/{tripID}", handleGetTrip(store))
+	mux.HandleFunc("PATCH /api/trips/{tripID}", handleUpdateTrip(store))
+	mux.HandleFunc("GET /api/trips/{tripID}/students", handleListStudents(store))
+	mux.HandleFunc("POST /api/trips/{tripID}/students", handleCreateStudent(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}", handleDeleteStudent(store))
+	mux.HandleFunc("POST /api/trips/{tripID}/students/{studentID}/parents", handleAddParent(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}/parents/{parentID}", handleRemoveParent(store))
+	mux.HandleFunc("GET /api/trips/{tripID}/constraints", handleListConstraints(store))
+	mux.HandleFunc("POST /api/trips/{tripID}/constraints", handleCreateConstraint(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}/constraints/{constraintID}", handleDeleteConstraint(store))
+	mux.HandleFunc("GET /api/trips/{tripID}/room-groups", handleListRoomGroups(store))
+	mux.HandleFunc("POST /api/trips/{tripID}/room-groups", handleCreateRoomGroup(store))
+	mux.HandleFunc("DELETE /api/trips/{tripID}/room-groups/{groupID}", handleDeleteRoomGroup(store))
+	return &testServer{store: store, mux: mux}
+}
+
+func (ts *testServer) login(t *testing.T, email string) string {
+	t.Helper()
+	token, err := createSession(ts.store, email)
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	return token
+}
+
+// do sends body as JSON and fails the test unless the response has status
+// want. It returns the response body.
+func (ts *testServer) do(t *testing.T, token, method, path string, body any, want int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ts.mux.ServeHTTP(rec, req)
+	if rec.Code != want {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, want, rec.Body.String())
+	}
+	return rec.Body.Bytes()
+}
+
+func decode[T any](t *testing.T, raw []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	return v
+}
+
+type idResponse struct {
+	ID int64 `json:"id"`
+}
+
+func (ts *testServer) createTrip(t *testing.T, token, name string) string {
+	t.Helper()
+	trip := decode[idResponse](t, ts.do(t, token, "POST", "/api/trips", map[string]any{"name": name}, http.StatusOK))
+	return "/api/trips/" + strconv.FormatInt(trip.ID, 10)
+}
+
+func (ts *testServer) createStudent(t *testing.T, token, tripPath, name, email string) int64 {
+	t.Helper()
+	return decode[idResponse](t, ts.do(t, token, "POST", tripPath+"/students", map[string]any{"name": name, "email": email}, http.StatusOK)).ID
+}
+
+func TestAuthorization(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	outsider := ts.login(t, "outsider@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+
+	ts.do(t, "", "GET", "/api/trips", nil, http.StatusUnauthorized)
+	ts.do(t, "not.a-token", "GET", "/api/trips", nil, http.StatusUnauthorized)
+	ts.do(t, outsider, "GET", "/api/trips", nil, http.StatusForbidden)
+	ts.do(t, outsider, "GET", tripPath, nil, http.StatusForbidden)
+	ts.do(t, outsider, "GET", tripPath+"/room-groups", nil, http.StatusForbidden)
+	ts.do(t, admin, "GET", "/api/trips/abc", nil, http.StatusBadRequest)
+
+	check := decode[map[string]bool](t, ts.do(t, outsider, "GET", "/api/admin/check", nil, http.StatusOK))
+	if check["admin"] {
+		t.Errorf("outsider reported as admin")
+	}
+	check = decode[map[string]bool](t, ts.do(t, admin, "GET", "/api/admin/check", nil, http.StatusOK))
+	if !check["admin"] {
+		t.Errorf("global admin not reported as admin")
+	}
+
+	// A session the store no longer knows about is rejected even though the
+	// token signature is valid.
+	delete(ts.store.sessions, decodeSessionID(t, outsider))
+	ts.do(t, outsider, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+
+	// Logging out revokes only the current session.
+	first := ts.login(t, "user@example.com")
+	second := ts.login(t, "user@example.com")
+	ts.do(t, first, "POST", "/auth/logout", nil, http.StatusNoContent)
+	ts.do(t, first, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+	ts.do(t, second, "GET", "/api/admin/check", nil, http.StatusOK)
+
+	// Logging out everywhere revokes every session of the user.
+	third := ts.login(t, "user@example.com")
+	ts.do(t, second, "POST", "/auth/logout-all", nil, http.StatusNoContent)
+	ts.do(t, second, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+	ts.do(t, third, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+
+	// Admins can revoke another user's sessions.
+	fourth := ts.login(t, "user@example.com")
+	ts.do(t, fourth, "POST", "/api/admin/sessions/revoke", map[string]any{"email": "user@example.com"}, http.StatusForbidden)
+	ts.do(t, admin, "POST", "/api/admin/sessions/revoke", map[string]any{"email": "user@example.com"}, http.StatusNoContent)
+	ts.do(t, fourth, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+	ts.do(t, admin, "GET", "/api/admin/check", nil, http.StatusOK)
+
+	// Use slides the idle expiry once the session has not been seen for a
+	// while, and a session left idle too long is rejected.
+	idle := ts.login(t, "idle@example.com")
+	id := decodeSessionID(t, idle)
+	session := ts.store.sessions[id]
+	session.lastSeen = time.Now().Add(-time.Hour)
+	session.idleExpiresAt = time.Now().Add(time.Minute)
+	ts.store.sessions[id] = session
+	ts.do(t, idle, "GET", "/api/admin/check", nil, http.StatusOK)
+	if got := ts.store.sessions[id].idleExpiresAt; time.Until(got) < sessionIdleTTL-time.Minute {
+		t.Errorf("idle expiry %v was not extended", got)
+	}
+	session = ts.store.sessions[id]
+	session.idleExpiresAt = time.Now().Add(-time.Second)
+	ts.store.sessions[id] = session
+	ts.do(t, idle, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+
+	// The absolute expiry holds however recently the session was used.
+	old := ts.login(t, "old@example.com")
+	id = decodeSessionID(t, old)
+	session = ts.store.sessions[id]
+	session.expiresAt = time.Now().Add(-time.Second)
+	ts.store.sessions[id] = session
+	ts.do(t, old, "GET", "/api/admin/check", nil, http.StatusUnauthorized)
+}
+
+func decodeSessionID(t *testing.T, token string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	claims, ok := parseToken(req)
+	if !ok {
+		t.Fatalf("token %q does not parse", token)
+	}
+	return claims.SessionID
+}
+
+func TestTripLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	ts.do(t, admin, "POST", "/api/trips", map[string]any{"name": ""}, http.StatusBadRequest)
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+
+	added := decode[idResponse](t, ts.do(t, admin, "POST", tripPath+"/admins", map[string]any{"email": "lead@example.com"}, http.StatusOK))
+	trips := decode[[]tripSummary](t, ts.do(t, admin, "GET", "/api/trips", nil, http.StatusOK))
+	if len(trips) != 1 || trips[0].Name != "Spring Trip" || len(trips[0].Admins) != 1 || trips[0].Admins[0].Email != "lead@example.com" {
+		t.Fatalf("trips = %+v", trips)
+	}
+
+	lead := ts.login(t, "lead@example.com")
+	trip := decode[tripRecord](t, ts.do(t, lead, "GET", tripPath, nil, http.StatusOK))
+	if trip.PreferNotMultiple != 5 || trip.NoPreferCost != 10 || !slices.Equal(trip.RankWeights, []int64{3, 2, 1}) || trip.Objective != "sum" {
+		t.Errorf("new trip settings = %+v", trip.tripSettings)
+	}
+	ts.do(t, lead, "DELETE", tripPath, nil, http.StatusForbidden)
+
+	ts.do(t, admin, "DELETE", tripPath+"/admins/"+strconv.FormatInt(added.ID, 10), nil, http.StatusNoContent)
+	ts.do(t, lead, "GET", tripPath, nil, http.StatusForbidden)
+
+	ts.do(t, admin, "DELETE", tripPath, nil, http.StatusNoContent)
+	ts.do(t, admin, "DELETE", tripPath, nil, http.StatusNotFound)
+	trips = decode[[]tripSummary](t, ts.do(t, admin, "GET", "/api/trips", nil, http.StatusOK))
+	if len(trips) != 0 {
+		t.Errorf("trips after delete = %+v", trips)
+	}
+
+	want := []string{"trip.create", "trip_admin.add", "trip_admin.remove", "trip.delete"}
+	if got := ts.store.auditActions(); !slices.Equal(got, want) {
+		t.Errorf("audit actions = %v, want %v", got, want)
+	}
+	if removed := ts.store.audit[2]; removed.TripID != trip.ID || removed.Before.(auditRow)["email"] != "lead@example.com" {
+		t.Errorf("trip_admin.remove entry = %+v", removed)
+	}
+}
+
+func TestCreateTripFromTemplate(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	ts.store.templates[7] = tripLayout{
+		Settings:   tripSettings{PreferNotMultiple: 3, NoPreferCost: 4, RankWeights: []int64{5, 1}, Objective: "sum"},
+		RoomGroups: []layoutRoomGroup{{Size: 2, Count: 1, Rooms: []layoutRoom{{Name: "101", Capacity: 2}}}},
+		Admins:     []string{"lead@example.com"},
+	}
+	ts.do(t, admin, "POST", "/api/trips", map[string]any{"name": "Copy", "template_id": 8}, http.StatusNotFound)
+	trip := decode[idResponse](t, ts.do(t, admin, "POST", "/api/trips", map[string]any{"name": "Copy", "template_id": 7}, http.StatusOK))
+	tripPath := "/api/trips/" + strconv.FormatInt(trip.ID, 10)
+
+	lead := ts.login(t, "lead@example.com")
+	settings := decode[tripRecord](t, ts.do(t, lead, "GET", tripPath, nil, http.StatusOK))
+	if settings.PreferNotMultiple != 3 || !slices.Equal(settings.RankWeights, []int64{5, 1}) {
+		t.Errorf("templated settings = %+v", settings.tripSettings)
+	}
+	groups := decode[[]roomGroupRecord](t, ts.do(t, lead, "GET", tripPath+"/room-groups", nil, http.StatusOK))
+	if len(groups) != 1 || groups[0].Size != 2 {
+		t.Errorf("templated room groups = %+v", groups)
+	}
+}
+
+func TestUpdateTrip(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+
+	for _, body := range []map[string]any{
+		{"prefer_not_multiple": 0},
+		{"no_prefer_cost": -1},
+		{"rank_weights": []int{}},
+		{"rank_weights": []int{2, 0}},
+		{"objective": "median"},
+		{"fairness_weight": -1},
+		{"underfill_cost": -3},
+		{"student_opens_at": "tomorrow"},
+	} {
+		ts.do(t, admin, "PATCH", tripPath, body, http.StatusBadRequest)
+	}
+
+	closes := time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)
+	ts.do(t, admin, "PATCH", tripPath, map[string]any{
+		"prefer_not_multiple": 2, "rank_weights": []int{4, 2}, "min_occupancy": 2,
+		"student_closes_at": closes.Format(time.RFC3339),
+	}, http.StatusNoContent)
+	trip := decode[tripRecord](t, ts.do(t, admin, "GET", tripPath, nil, http.StatusOK))
+	if trip.PreferNotMultiple != 2 || trip.NoPreferCost != 10 || !slices.Equal(trip.RankWeights, []int64{4, 2}) || trip.MinOccupancy != 2 {
+		t.Errorf("updated settings = %+v", trip.tripSettings)
+	}
+	if trip.StudentClosesAt == nil || !trip.StudentClosesAt.Equal(closes) {
+		t.Errorf("student_closes_at = %v, want %v", trip.StudentClosesAt, closes)
+	}
+
+	ts.do(t, admin, "PATCH", tripPath, map[string]any{"student_closes_at": ""}, http.StatusNoContent)
+	trip = decode[tripRecord](t, ts.do(t, admin, "GET", tripPath, nil, http.StatusOK))
+	if trip.StudentClosesAt != nil {
+		t.Errorf("student_closes_at = %v after clearing", trip.StudentClosesAt)
+	}
+
+	update := ts.store.audit[len(ts.store.audit)-2]
+	if update.Action != "trip.update" || update.Before.(auditRow).int64("prefer_not_multiple") != 5 || update.After.(auditRow).int64("prefer_not_multiple") != 2 {
+		t.Errorf("trip.update entry = %+v", update)
+	}
+}
+
+func TestStudentsAndParents(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+
+	ts.do(t, admin, "POST", tripPath+"/students", map[string]any{"name": "Ana"}, http.StatusBadRequest)
+	ana := ts.createStudent(t, admin, tripPath, "Ana", "ana@example.com")
+	ts.createStudent(t, admin, tripPath, "Ben", "ben@example.com")
+	ts.do(t, admin, "POST", tripPath+"/students", map[string]any{"name": "Ana Again", "email": "ana@example.com"}, http.StatusInternalServerError)
+	anaPath := tripPath + "/students/" + strconv.FormatInt(ana, 10)
+	parent := decode[idResponse](t, ts.do(t, admin, "POST", anaPath+"/parents", map[string]any{"email": "mum@example.com"}, http.StatusOK))
+
+	students := decode[[]studentRecord](t, ts.do(t, admin, "GET", tripPath+"/students", nil, http.StatusOK))
+	if len(students) != 2 || students[0].Name != "Ana" || len(students[0].Parents) != 1 || students[0].Parents[0].Email != "mum@example.com" {
+		t.Fatalf("admin student list = %+v", students)
+	}
+
+	// Students and parents only see names.
+	student := ts.login(t, "ana@example.com")
+	raw := ts.do(t, student, "GET", tripPath+"/students", nil, http.StatusOK)
+	for _, s := range decode[[]map[string]any](t, raw) {
+		if _, ok := s["email"]; ok {
+			t.Errorf("student list leaks emails: %s", raw)
+		}
+	}
+	ts.do(t, student, "POST", tripPath+"/students", map[string]any{"name": "Cy", "email": "cy@example.com"}, http.StatusForbidden)
+
+	mum := ts.login(t, "mum@example.com")
+	type me struct {
+		Role     string `json:"role"`
+		Students []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+			Open bool   `json:"open"`
+		} `json:"students"`
+	}
+	got := decode[me](t, ts.do(t, mum, "GET", tripPath+"/me", nil, http.StatusOK))
+	if got.Role != "parent" || len(got.Students) != 1 || got.Students[0].ID != ana || !got.Students[0].Open {
+		t.Errorf("parent /me = %+v", got)
+	}
+
+	ts.do(t, admin, "DELETE", anaPath+"/parents/"+strconv.FormatInt(parent.ID, 10), nil, http.StatusNoContent)
+	ts.do(t, mum, "GET", tripPath+"/me", nil, http.StatusForbidden)
+	ts.do(t, admin, "DELETE", anaPath, nil, http.StatusNoContent)
+	ts.do(t, admin, "DELETE", anaPath, nil, http.StatusNotFound)
+	ts.do(t, student, "GET", tripPath+"/me", nil, http.StatusForbidden)
+
+	entry := ts.store.audit[len(ts.store.audit)-1]
+	if entry.Action != "student.delete" || !slices.Equal(entry.StudentIDs, []int64{ana}) || entry.Before.(auditRow)["name"] != "Ana" {
+		t.Errorf("student.delete entry = %+v", entry)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+	ana := ts.createStudent(t, admin, tripPath, "Ana", "ana@example.com")
+	ben := ts.createStudent(t, admin, tripPath, "Ben", "ben@example.com")
+	cy := ts.createStudent(t, admin, tripPath, "Cy", "cy@example.com")
+	student := ts.login(t, "ana@example.com")
+
+	for _, tc := range []struct {
+		body map[string]any
+		want int
+	}{
+		{map[string]any{"student_a_id": ana, "student_b_id": ana, "kind": "prefer", "level": "student"}, http.StatusBadRequest},
+		{map[string]any{"student_a_id": ana, "student_b_id": ben, "kind": "must", "level": "student"}, http.StatusBadRequest},
+		{map[string]any{"student_a_id": ana, "student_b_id": ben, "kind": "prefer", "level": "student", "rank": 4}, http.StatusBadRequest},
+		{map[string]any{"student_a_id": ana, "student_b_id": ben, "kind": "prefer_not", "level": "student", "rank": 1}, http.StatusBadRequest},
+		{map[string]any{"student_a_id": ana, "student_b_id": ben, "kind": "must", "level": "admin"}, http.StatusForbidden},
+		{map[string]any{"student_a_id": ben, "student_b_id": ana, "kind": "prefer", "level": "student"}, http.StatusForbidden},
+	} {
+		ts.do(t, student, "POST", tripPath+"/constraints", tc.body, tc.want)
+	}
+
+	prefer := map[string]any{"student_a_id": ana, "student_b_id": ben, "kind": "prefer", "level": "student", "rank": 1}
+	first := decode[idResponse](t, ts.do(t, student, "POST", tripPath+"/constraints", prefer, http.StatusOK))
+	prefer["rank"] = 2
+	second := decode[idResponse](t, ts.do(t, student, "POST", tripPath+"/constraints", prefer, http.StatusOK))
+	if first.ID != second.ID {
+		t.Errorf("re-setting a constraint created %d instead of updating %d", second.ID, first.ID)
+	}
+	set := ts.store.audit[len(ts.store.audit)-1]
+	if set.Before.(auditRow).int64("rank") != 1 || set.After.(auditRow).int64("rank") != 2 {
+		t.Errorf("constraint.set entry = %+v", set)
+	}
+	ts.do(t, admin, "POST", tripPath+"/constraints", map[string]any{"student_a_id": ben, "student_b_id": ana, "kind": "prefer_not", "level": "admin"}, http.StatusOK)
+
+	type listing struct {
+		Constraints []struct {
+			ID       int64   `json:"id"`
+			Level    string  `json:"level"`
+			Override *string `json:"override"`
+		} `json:"constraints"`
+		Overalls   []map[string]any `json:"overalls"`
+		Mismatches []map[string]any `json:"mismatches"`
+	}
+	mine := decode[listing](t, ts.do(t, student, "GET", tripPath+"/constraints", nil, http.StatusOK))
+	if len(mine.Constraints) != 1 || mine.Constraints[0].ID != first.ID || len(mine.Overalls) != 0 {
+		t.Errorf("student listing = %+v", mine)
+	}
+	all := decode[listing](t, ts.do(t, admin, "GET", tripPath+"/constraints", nil, http.StatusOK))
+	if len(all.Constraints) != 2 || len(all.Overalls) != 2 || len(all.Mismatches) != 1 {
+		t.Errorf("admin listing = %+v", all)
+	}
+
+	// Closing the student window locks students out but not admins.
+	ts.do(t, admin, "PATCH", tripPath, map[string]any{"student_closes_at": time.Now().Add(-time.Hour).Format(time.RFC3339)}, http.StatusNoContent)
+	ts.do(t, student, "POST", tripPath+"/constraints", map[string]any{"student_a_id": ana, "student_b_id": cy, "kind": "prefer", "level": "student"}, http.StatusForbidden)
+	constraintPath := tripPath + "/constraints/" + strconv.FormatInt(first.ID, 10)
+	ts.do(t, student, "DELETE", constraintPath, nil, http.StatusForbidden)
+
+	// A window extension lets that one student keep going.
+	ts.store.extensions = append(ts.store.extensions, &memWindowExtension{ID: ts.store.id(), StudentID: ana, Level: "student", ClosesAt: time.Now().Add(time.Hour), GrantedBy: "admin@example.com"})
+	extended := decode[idResponse](t, ts.do(t, student, "POST", tripPath+"/constraints", map[string]any{"student_a_id": ana, "student_b_id": cy, "kind": "prefer", "level": "student"}, http.StatusOK))
+	ts.do(t, student, "DELETE", tripPath+"/constraints/"+strconv.FormatInt(extended.ID, 10), nil, http.StatusNoContent)
+	cyToken := ts.login(t, "cy@example.com")
+	ts.do(t, cyToken, "POST", tripPath+"/constraints", map[string]any{"student_a_id": cy, "student_b_id": ana, "kind": "prefer", "level": "student"}, http.StatusForbidden)
+	ts.store.extensions = nil
+	ts.do(t, admin, "PATCH", tripPath, map[string]any{"student_closes_at": ""}, http.StatusNoContent)
+
+	ben2 := ts.login(t, "ben@example.com")
+	ts.do(t, ben2, "DELETE", constraintPath, nil, http.StatusNotFound)
+	ts.do(t, student, "DELETE", constraintPath, nil, http.StatusNoContent)
+	ts.do(t, student, "DELETE", constraintPath, nil, http.StatusNotFound)
+
+	// Deleting a student drops the constraints that mention them.
+	ts.do(t, admin, "DELETE", tripPath+"/students/"+strconv.FormatInt(ben, 10), nil, http.StatusNoContent)
+	all = decode[listing](t, ts.do(t, admin, "GET", tripPath+"/constraints", nil, http.StatusOK))
+	if len(all.Constraints) != 0 {
+		t.Errorf("constraints after deleting student = %+v", all.Constraints)
+	}
+}
+
+func TestConstraintConflicts(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+	ana := ts.createStudent(t, admin, tripPath, "Ana", "ana@example.com")
+	ben := ts.createStudent(t, admin, tripPath, "Ben", "ben@example.com")
+	cy := ts.createStudent(t, admin, tripPath, "Cy", "cy@example.com")
+	ts.do(t, admin, "POST", tripPath+"/room-groups", map[string]any{"size": 2, "count": 2}, http.StatusOK)
+
+	for _, c := range []struct {
+		a, b int64
+		kind string
+	}{{ana, ben, "must"}, {ben, cy, "must"}, {ana, cy, "must_not"}} {
+		ts.do(t, admin, "POST", tripPath+"/constraints", map[string]any{"student_a_id": c.a, "student_b_id": c.b, "kind": c.kind, "level": "admin"}, http.StatusOK)
+	}
+	type conflicts struct {
+		HardConflicts   [][]map[string]string `json:"hard_conflicts"`
+		OversizedGroups [][]string            `json:"oversized_groups"`
+	}
+	got := decode[conflicts](t, ts.do(t, admin, "GET", tripPath+"/constraints", nil, http.StatusOK))
+	if len(got.HardConflicts) != 1 || len(got.HardConflicts[0]) != 3 {
+		t.Errorf("hard_conflicts = %+v", got.HardConflicts)
+	}
+	if len(got.OversizedGroups) != 1 || len(got.OversizedGroups[0]) != 3 {
+		t.Errorf("oversized_groups = %+v", got.OversizedGroups)
+	}
+}
+
+func TestRoomGroups(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login(t, "admin@example.com")
+	tripPath := ts.createTrip(t, admin, "Spring Trip")
+	otherPath := ts.createTrip(t, admin, "Autumn Trip")
+
+	ts.do(t, admin, "POST", tripPath+"/room-groups", map[string]any{"size": 0, "count": 2}, http.StatusBadRequest)
+	group := decode[idResponse](t, ts.do(t, admin, "POST", tripPath+"/room-groups", map[string]any{"size": 3, "count": 2, "building": "North", "start_number": 101}, http.StatusOK))
+	groups := decode[[]roomGroupRecord](t, ts.do(t, admin, "GET", tripPath+"/room-groups", nil, http.StatusOK))
+	if len(groups) != 1 || groups[0] != (roomGroupRecord{ID: group.ID, Size: 3, Count: 2}) {
+		t.Fatalf("room groups = %+v", groups)
+	}
+	var names []string
+	for _, room := range ts.store.rooms {
+		names = append(names, room.Name+"/"+room.Building)
+	}
+	if !slices.Equal(names, []string{"101/North", "102/North"}) {
+		t.Errorf("rooms = %v", names)
+	}
+
+	groupPath := "/room-groups/" + strconv.FormatInt(group.ID, 10)
+	ts.do(t, admin, "DELETE", otherPath+groupPath, nil, http.StatusNotFound)
+	ts.do(t, admin, "DELETE", tripPath+groupPath, nil, http.StatusNoContent)
+	if len(ts.store.rooms) != 0 {
+		t.Errorf("rooms left after deleting their group: %+v", ts.store.rooms)
+	}
+	groups = decode[[]roomGroupRecord](t, ts.do(t, admin, "GET", tripPath+"/room-groups", nil, http.StatusOK))
+	if len(groups) != 0 {
+		t.Errorf("room groups after delete = %+v", groups)
+	}
+}
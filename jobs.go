@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rooms/solver"
+)
+
+const (
+	jobRetention          = 30 * time.Minute
+	maxNumRandom          = 10000
+	maxNumPerturb         = 100000
+	maxWorkers            = 64
+	maxRunningJobs        = 8
+	defaultExactTimeLimit = 30 * time.Second
+	maxTimeLimit          = 10 * time.Minute
+)
+
+// defaultSolveParams spreads a solve job's heuristic over every CPU the server
+// may use. Jobs are capped by maxRunningJobs; the synchronous solve is not, so
+// it keeps to one worker.
+func defaultSolveParams() solver.Params {
+	params := solver.DefaultParams
+	params.Workers = runtime.GOMAXPROCS(0)
+	return params
+}
+
+type solveBackend struct {
+	solver    solver.Solver
+	timeLimit time.Duration
+}
+
+func newSolveBackend(name string, params solver.Params, timeLimitSeconds *int) (solveBackend, error) {
+	if name == "" {
+		name = "fast"
+	}
+	var b solveBackend
+	if name == "exact" {
+		b.timeLimit = defaultExactTimeLimit
+	}
+	if timeLimitSeconds != nil {
+		b.timeLimit = time.Duration(*timeLimitSeconds) * time.Second
+		if b.timeLimit <= 0 || b.timeLimit > maxTimeLimit {
+			return b, fmt.Errorf("time_limit must be between 1 and %d seconds", int(maxTimeLimit/time.Second))
+		}
+		if name == "fast" {
+			params.Budget = b.timeLimit
+		}
+	}
+	s, err := solver.New(name, solver.Options{Params: params, Rand: rand.New(rand.NewSource(42))})
+	if err != nil {
+		return b, fmt.Errorf("backend must be one of %s", strings.Join(solver.Strategies(), ", "))
+	}
+	b.solver = s
+	return b, nil
+}
+
+type solveStats struct {
+	Iterations       int   `json:"iterations"`
+	BestIteration    int   `json:"best_iteration"`
+	BestFoundAfterMS int64 `json:"best_found_after_ms"`
+}
+
+func newSolveStats(s solver.Stats) *solveStats {
+	if s.Iterations == 0 {
+		return nil
+	}
+	return &solveStats{s.Iterations, s.BestIteration, s.BestFoundAfter.Milliseconds()}
+}
+
+func (b solveBackend) solve(ctx context.Context, in *solveInput, progress func(solver.Progress)) (solver.Result, error) {
+	if b.timeLimit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeLimit)
+		defer cancel()
+	}
+	return b.solver.Solve(ctx, in.problem, progress)
+}
+
+type solveJob struct {
+	mu        sync.Mutex
+	id        int64
+	tripID    int64
+	status    string
+	progress  solver.Progress
+	solutions []solutionResult
+	optimal   bool
+	bound     *int
+	stats     *solveStats
+	err       string
+	cancel    context.CancelFunc
+}
+
+// solveJobs holds every job still within its retention window; running
+// tracks the one job each trip may have in flight.
+var solveJobs = struct {
+	sync.Mutex
+	next    int64
+	byID    map[int64]*solveJob
+	running map[int64]*solveJob
+}{byID: map[int64]*solveJob{}, running: map[int64]*solveJob{}}
+
+func (j *solveJob) run(ctx context.Context, in *solveInput, backend solveBackend) {
+	defer func() {
+		solveJobs.Lock()
+		delete(solveJobs.running, j.tripID)
+		solveJobs.Unlock()
+	}()
+	result, err := backend.solve(ctx, in, func(p solver.Progress) {
+		j.mu.Lock()
+		total := j.progress.Total
+		j.progress = p
+		if p.Total == 0 {
+			j.progress.Total = total
+		}
+		j.mu.Unlock()
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.optimal, j.bound = result.Optimal, result.Bound
+	j.stats = newSolveStats(result.Stats)
+	switch {
+	case ctx.Err() != nil:
+		j.status = "cancelled"
+		j.solutions = solutionResults(in, result.Solutions)
+	case err != nil:
+		j.status = "failed"
+		j.err = err.Error()
+	default:
+		j.status = "done"
+		j.solutions = solutionResults(in, result.Solutions)
+	}
+	j.cancel()
+	j.expire()
+}
+
+func (j *solveJob) expire() {
+	time.AfterFunc(jobRetention, func() {
+		solveJobs.Lock()
+		delete(solveJobs.byID, j.id)
+		solveJobs.Unlock()
+	})
+}
+
+func (j *solveJob) MarshalJSON() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	type progress struct {
+		Iterations int `json:"iterations"`
+		Total      int `json:"total"`
+		BestScore  int `json:"best_score"`
+	}
+	return json.Marshal(struct {
+		ID        int64            `json:"id"`
+		Status    string           `json:"status"`
+		Progress  progress         `json:"progress"`
+		Solutions []solutionResult `json:"solutions,omitempty"`
+		Optimal   bool             `json:"optimal"`
+		Bound     *int             `json:"bound,omitempty"`
+		Stats     *solveStats      `json:"stats,omitempty"`
+		Error     string           `json:"error,omitempty"`
+	}{j.id, j.status, progress{j.progress.Iterations, j.progress.Total, j.progress.BestScore}, j.solutions, j.optimal, j.bound, j.stats, j.err})
+}
+
+func lookupSolveJob(w http.ResponseWriter, r *http.Request, tripID int64) (*solveJob, bool) {
+	jobID, err := strconv.ParseInt(r.PathValue("jobID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job ID", http.StatusBadRequest)
+		return nil, false
+	}
+	solveJobs.Lock()
+	j := solveJobs.byID[jobID]
+	solveJobs.Unlock()
+	if j == nil || j.tripID != tripID {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return j, true
+}
+
+func handleCreateSolveJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Backend    string `json:"backend"`
+			TimeLimit  *int   `json:"time_limit"`
+			NumRandom  *int   `json:"num_random"`
+			NumPerturb *int   `json:"num_perturb"`
+			PerturbMin *int   `json:"perturb_min"`
+			PerturbMax *int   `json:"perturb_max"`
+			Workers    *int   `json:"workers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		params := defaultSolveParams()
+		if body.NumRandom != nil {
+			params.NumRandom = *body.NumRandom
+		}
+		if body.NumPerturb != nil {
+			params.NumPerturb = *body.NumPerturb
+		}
+		if body.PerturbMin != nil {
+			params.PerturbMin = *body.PerturbMin
+		}
+		if body.PerturbMax != nil {
+			params.PerturbMax = *body.PerturbMax
+		}
+		if body.Workers != nil {
+			params.Workers = *body.Workers
+		}
+		if params.NumRandom < 0 || params.NumRandom > maxNumRandom {
+			http.Error(w, "num_random must be between 0 and "+strconv.Itoa(maxNumRandom), http.StatusBadRequest)
+			return
+		}
+		if params.NumPerturb < 0 || params.NumPerturb > maxNumPerturb {
+			http.Error(w, "num_perturb must be between 0 and "+strconv.Itoa(maxNumPerturb), http.StatusBadRequest)
+			return
+		}
+		if params.PerturbMin < 1 || params.PerturbMax <= params.PerturbMin {
+			http.Error(w, "perturb_min must be at least 1 and less than perturb_max", http.StatusBadRequest)
+			return
+		}
+		if params.Workers < 1 || params.Workers > maxWorkers {
+			http.Error(w, "workers must be between 1 and "+strconv.Itoa(maxWorkers), http.StatusBadRequest)
+			return
+		}
+		backend, err := newSolveBackend(body.Backend, params, body.TimeLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		in, ok := loadSolveInput(db, w, tripID)
+		if !ok {
+			return
+		}
+		if len(in.studentIDs) > 0 && !requireFeasible(w, in) {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		j := &solveJob{tripID: tripID, status: "running", cancel: cancel}
+		if (body.Backend == "" || body.Backend == "fast") && body.TimeLimit == nil {
+			j.progress.Total = params.NumRandom + params.NumPerturb
+		}
+		if len(in.studentIDs) == 0 {
+			j.status = "done"
+			j.solutions = []solutionResult{}
+			cancel()
+		}
+		solveJobs.Lock()
+		if j.status == "running" {
+			if solveJobs.running[tripID] != nil {
+				solveJobs.Unlock()
+				cancel()
+				http.Error(w, "a solve is already running for this trip", http.StatusConflict)
+				return
+			}
+			if len(solveJobs.running) >= maxRunningJobs {
+				solveJobs.Unlock()
+				cancel()
+				http.Error(w, "too many solves running, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+			solveJobs.running[tripID] = j
+		}
+		solveJobs.next++
+		j.id = solveJobs.next
+		solveJobs.byID[j.id] = j
+		solveJobs.Unlock()
+
+		if j.status == "running" {
+			go j.run(ctx, in, backend)
+		} else {
+			j.expire()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j)
+	}
+}
+
+func handleGetSolveJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		j, ok := lookupSolveJob(w, r, tripID)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j)
+	}
+}
+
+func handleCancelSolveJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		j, ok := lookupSolveJob(w, r, tripID)
+		if !ok {
+			return
+		}
+		j.cancel()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mailer delivers a single plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// newMailer sends through SMTP_ADDR when it is set. Otherwise mail goes to
+// .eml files in MAIL_DIR, or to the log with MAIL_SINK=log. With none of
+// these it returns a nil Mailer and notifications stay queued.
+func newMailer() (Mailer, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" && os.Getenv("MAIL_SINK") != "log" {
+			return nil, nil
+		}
+		return sinkMailer{dir: dir}, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_ADDR must be host:port: %w", err)
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, errors.New("MAIL_FROM is required with SMTP_ADDR")
+	}
+	m := smtpMailer{addr: addr, from: from}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+func formatEmail(from, to, subject, body string) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m smtpMailer) Send(to, subject, body string) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, formatEmail(m.from, to, subject, body))
+}
+
+type sinkMailer struct {
+	dir string
+}
+
+func (m sinkMailer) Send(to, subject, body string) error {
+	if m.dir == "" {
+		log.Printf("mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+	f, err := os.CreateTemp(m.dir, strings.ReplaceAll(to, string(filepath.Separator), "_")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(formatEmail(os.Getenv("MAIL_FROM"), to, subject, body)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -2,22 +2,20 @@ package main
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
 	"database/sql"
-	_ "embed"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/lib/pq"
 	"google.golang.org/api/idtoken"
@@ -25,9 +23,6 @@ import (
 	"rooms/solver"
 )
 
-//go:embed schema.sql
-var schema string
-
 var (
 	htmlTemplates *template.Template
 	jsTemplates   *texttemplate.Template
@@ -39,7 +34,12 @@ var (
 )
 
 func main() {
-	for _, key := range []string{"PGCONN", "CLIENT_ID", "CLIENT_SECRET", "ADMINS"} {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+
+	for _, key := range []string{"PGCONN", "CLIENT_ID", "CLIENT_SECRET"} {
 		if os.Getenv(key) == "" {
 			log.Fatalf("%s environment variable is required", key)
 		}
@@ -56,9 +56,24 @@ func main() {
 	}
 	log.Println("connected to database")
 
-	if _, err := db.Exec(schema); err != nil {
-		log.Fatalf("failed to apply schema: %v", err)
+	if err := migrateUp(db); err != nil {
+		log.Fatalf("failed to migrate database: %v", err)
+	}
+
+	if err := bootstrapGlobalAdmins(db); err != nil {
+		log.Fatalf("failed to bootstrap admins: %v", err)
+	}
+
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("failed to configure mail: %v", err)
 	}
+	if mailer == nil {
+		log.Println("warning: mail is not configured (set SMTP_ADDR, MAIL_DIR or MAIL_SINK=log); notifications will stay queued")
+	}
+	go runNotifier(db, mailer)
+
+	store := postgresStore{db}
 
 	htmlTemplates = template.Must(template.New("").ParseGlob("static/*.html"))
 	jsTemplates = texttemplate.Must(texttemplate.New("").ParseGlob("static/*.js"))
@@ -67,30 +82,69 @@ func main() {
 	http.HandleFunc("GET /admin", serveHTML("admin.html"))
 	http.HandleFunc("GET /app.js", serveJS("app.js"))
 	http.HandleFunc("GET /admin.js", serveJS("admin.js"))
-	http.HandleFunc("POST /auth/google/callback", handleGoogleCallback)
-	http.HandleFunc("GET /api/admin/check", handleAdminCheck)
-	http.HandleFunc("GET /api/trips", handleListTrips(db))
-	http.HandleFunc("POST /api/trips", handleCreateTrip(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}", handleDeleteTrip(db))
-	http.HandleFunc("POST /api/trips/{tripID}/admins", handleAddTripAdmin(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}/admins/{adminID}", handleRemoveTripAdmin(db))
+	http.HandleFunc("POST /auth/google/callback", handleGoogleCallback(db))
+	http.HandleFunc("POST /auth/logout", handleLogout(store))
+	http.HandleFunc("POST /auth/logout-all", handleLogoutAll(store))
+	http.HandleFunc("GET /api/admin/check", handleAdminCheck(store))
+	http.HandleFunc("POST /api/admin/sessions/revoke", handleRevokeUserSessions(store))
+	http.HandleFunc("GET /api/admin/admins", handleListGlobalAdmins(db))
+	http.HandleFunc("POST /api/admin/admins", handleAddGlobalAdmin(db))
+	http.HandleFunc("DELETE /api/admin/admins/{adminID}", handleRemoveGlobalAdmin(db))
+	http.HandleFunc("GET /api/admin/audit", handleAuditLog(db))
+	http.HandleFunc("GET /api/trips", handleListTrips(store))
+	http.HandleFunc("POST /api/trips", handleCreateTrip(store))
+	http.HandleFunc("DELETE /api/trips/{tripID}", handleDeleteTrip(store))
+	http.HandleFunc("POST /api/trips/{tripID}/clone", handleCloneTrip(db))
+	http.HandleFunc("GET /api/admin/templates", handleListTripTemplates(db))
+	http.HandleFunc("POST /api/admin/templates", handleCreateTripTemplate(db))
+	http.HandleFunc("DELETE /api/admin/templates/{templateID}", handleDeleteTripTemplate(db))
+	http.HandleFunc("POST /api/trips/{tripID}/admins", handleAddTripAdmin(store))
+	http.HandleFunc("DELETE /api/trips/{tripID}/admins/{adminID}", handleRemoveTripAdmin(store))
 	http.HandleFunc("GET /trip/{tripID}", serveHTML("trip.html"))
 	http.HandleFunc("GET /trip.js", serveJS("trip.js"))
-	http.HandleFunc("GET /api/trips/{tripID}/me", handleTripMe(db))
-	http.HandleFunc("GET /api/trips/{tripID}", handleGetTrip(db))
-	http.HandleFunc("PATCH /api/trips/{tripID}", handleUpdateTrip(db))
-	http.HandleFunc("GET /api/trips/{tripID}/students", handleListStudents(db))
-	http.HandleFunc("POST /api/trips/{tripID}/students", handleCreateStudent(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}", handleDeleteStudent(db))
-	http.HandleFunc("POST /api/trips/{tripID}/students/{studentID}/parents", handleAddParent(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}/parents/{parentID}", handleRemoveParent(db))
-	http.HandleFunc("GET /api/trips/{tripID}/constraints", handleListConstraints(db))
-	http.HandleFunc("POST /api/trips/{tripID}/constraints", handleCreateConstraint(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}/constraints/{constraintID}", handleDeleteConstraint(db))
-	http.HandleFunc("GET /api/trips/{tripID}/room-groups", handleListRoomGroups(db))
-	http.HandleFunc("POST /api/trips/{tripID}/room-groups", handleCreateRoomGroup(db))
-	http.HandleFunc("DELETE /api/trips/{tripID}/room-groups/{groupID}", handleDeleteRoomGroup(db))
+	http.HandleFunc("GET /api/trips/{tripID}/me", handleTripMe(store))
+	http.HandleFunc("GET /api/trips/{tripID}/me/room", handleMyRoom(db))
+	http.HandleFunc("GET /api/trips/{tripID}", handleGetTrip(store))
+	http.HandleFunc("PATCH /api/trips/{tripID}", handleUpdateTrip(store))
+	http.HandleFunc("GET /api/trips/{tripID}/audit", handleTripAuditLog(db))
+	http.HandleFunc("GET /api/trips/{tripID}/notifications", handleListNotifications(db))
+	http.HandleFunc("POST /api/trips/{tripID}/notifications/invite", handleSendInvites(db))
+	http.HandleFunc("GET /api/trips/{tripID}/extensions", handleListWindowExtensions(db))
+	http.HandleFunc("PUT /api/trips/{tripID}/extensions", handleSetWindowExtension(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/extensions/{extensionID}", handleDeleteWindowExtension(db))
+	http.HandleFunc("GET /api/trips/{tripID}/students", handleListStudents(store))
+	http.HandleFunc("POST /api/trips/{tripID}/students", handleCreateStudent(store))
+	http.HandleFunc("POST /api/trips/{tripID}/students/import", handleImportStudents(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}", handleDeleteStudent(store))
+	http.HandleFunc("POST /api/trips/{tripID}/students/{studentID}/parents", handleAddParent(store))
+	http.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}/parents/{parentID}", handleRemoveParent(store))
+	http.HandleFunc("PUT /api/trips/{tripID}/students/{studentID}/attributes/{key}", handleSetStudentAttribute(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/students/{studentID}/attributes/{key}", handleDeleteStudentAttribute(db))
+	http.HandleFunc("GET /api/trips/{tripID}/constraints", handleListConstraints(store))
+	http.HandleFunc("POST /api/trips/{tripID}/constraints", handleCreateConstraint(store))
+	http.HandleFunc("DELETE /api/trips/{tripID}/constraints/{constraintID}", handleDeleteConstraint(store))
+	http.HandleFunc("GET /api/trips/{tripID}/room-groups", handleListRoomGroups(store))
+	http.HandleFunc("POST /api/trips/{tripID}/room-groups", handleCreateRoomGroup(store))
+	http.HandleFunc("DELETE /api/trips/{tripID}/room-groups/{groupID}", handleDeleteRoomGroup(store))
+	http.HandleFunc("GET /api/trips/{tripID}/rooms", handleListRooms(db))
+	http.HandleFunc("PATCH /api/trips/{tripID}/rooms/{roomID}", handleUpdateRoom(db))
+	http.HandleFunc("GET /api/trips/{tripID}/pins", handleListPins(db))
+	http.HandleFunc("POST /api/trips/{tripID}/pins", handlePinStudents(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/pins/{studentID}", handleUnpinStudent(db))
+	http.HandleFunc("GET /api/trips/{tripID}/room-rules", handleListRoomRules(db))
+	http.HandleFunc("POST /api/trips/{tripID}/room-rules", handleCreateRoomRule(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/room-rules/{ruleID}", handleDeleteRoomRule(db))
+	http.HandleFunc("GET /api/trips/{tripID}/solve-diagnostics", handleSolveDiagnostics(db))
 	http.HandleFunc("POST /api/trips/{tripID}/solve", handleSolve(db))
+	http.HandleFunc("POST /api/trips/{tripID}/solve-jobs", handleCreateSolveJob(db))
+	http.HandleFunc("GET /api/trips/{tripID}/solve-jobs/{jobID}", handleGetSolveJob(db))
+	http.HandleFunc("DELETE /api/trips/{tripID}/solve-jobs/{jobID}", handleCancelSolveJob(db))
+	http.HandleFunc("GET /api/trips/{tripID}/assignments", handleListAssignments(db))
+	http.HandleFunc("POST /api/trips/{tripID}/assignments", handleCreateAssignment(db))
+	http.HandleFunc("GET /api/trips/{tripID}/assignments/{assignmentID}", handleGetAssignment(db))
+	http.HandleFunc("POST /api/trips/{tripID}/assignments/{assignmentID}/publish", handlePublishAssignment(db))
+	http.HandleFunc("GET /api/trips/{tripID}/assignments/{assignmentID}/export", handleExportAssignment(db))
+	http.HandleFunc("POST /api/trips/{tripID}/export", handleExportSolution(db))
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		if err := db.Ping(); err != nil {
 			http.Error(w, "db unhealthy", http.StatusServiceUnavailable)
@@ -137,84 +191,56 @@ func serveJS(name string) http.HandlerFunc {
 	}
 }
 
-func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	credential := r.FormValue("credential")
-	if credential == "" {
-		http.Error(w, "missing credential", http.StatusBadRequest)
-		return
-	}
-
-	payload, err := idtoken.Validate(context.Background(), credential, os.Getenv("CLIENT_ID"))
-	if err != nil {
-		log.Println("failed to validate token:", err)
-		http.Error(w, "invalid token", http.StatusUnauthorized)
-		return
-	}
+func handleGoogleCallback(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		credential := r.FormValue("credential")
+		if credential == "" {
+			http.Error(w, "missing credential", http.StatusBadRequest)
+			return
+		}
 
-	email := payload.Claims["email"].(string)
+		payload, err := idtoken.Validate(context.Background(), credential, os.Getenv("CLIENT_ID"))
+		if err != nil {
+			log.Println("failed to validate token:", err)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
 
-	profile := map[string]any{
-		"email":   email,
-		"name":    payload.Claims["name"],
-		"picture": payload.Claims["picture"],
-		"token":   signEmail(email),
-	}
+		email := payload.Claims["email"].(string)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(profile)
-}
+		token, err := createSession(postgresStore{db}, email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-func signEmail(email string) string {
-	h := hmac.New(sha256.New, []byte(os.Getenv("CLIENT_SECRET")))
-	h.Write([]byte(email))
-	sig := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-	return base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + sig
-}
+		profile := map[string]any{
+			"email":   email,
+			"name":    payload.Claims["name"],
+			"picture": payload.Claims["picture"],
+			"token":   token,
+		}
 
-func authorize(r *http.Request) (string, bool) {
-	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	parts := strings.SplitN(token, ".", 2)
-	if len(parts) != 2 {
-		return "", false
-	}
-	emailBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
-	if err != nil {
-		return "", false
-	}
-	email := string(emailBytes)
-	if signEmail(email) != token {
-		return "", false
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
 	}
-	return email, true
 }
 
-func isAdmin(email string) bool {
-	return slices.ContainsFunc(strings.Split(os.Getenv("ADMINS"), ","), func(a string) bool {
-		return strings.TrimSpace(a) == email
-	})
-}
-
-func requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
-	email, ok := authorize(r)
+func requireAdmin(store Store, w http.ResponseWriter, r *http.Request) (string, bool) {
+	email, ok := authorize(store, r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return "", false
 	}
-	if !isAdmin(email) {
+	if !store.IsGlobalAdmin(email) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return "", false
 	}
 	return email, true
 }
 
-func isTripAdmin(db *sql.DB, email string, tripID int64) bool {
-	var exists bool
-	db.QueryRow("SELECT EXISTS(SELECT 1 FROM trip_admins WHERE trip_id = $1 AND email = $2)", tripID, email).Scan(&exists)
-	return exists
-}
-
-func requireTripAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) (string, int64, bool) {
-	email, ok := authorize(r)
+func requireTripAdmin(store Store, w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	email, ok := authorize(store, r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return "", 0, false
@@ -224,47 +250,28 @@ func requireTripAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) (strin
 		http.Error(w, "invalid trip ID", http.StatusBadRequest)
 		return "", 0, false
 	}
-	if !isAdmin(email) && !isTripAdmin(db, email, tripID) {
+	if !store.IsGlobalAdmin(email) && !store.IsTripAdmin(email, tripID) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return "", 0, false
 	}
 	return email, tripID, true
 }
 
-func tripRole(db *sql.DB, email string, tripID int64) (string, []int64) {
-	if isAdmin(email) || isTripAdmin(db, email, tripID) {
+func tripRole(store Store, email string, tripID int64) (string, []int64) {
+	if store.IsGlobalAdmin(email) || store.IsTripAdmin(email, tripID) {
 		return "admin", nil
 	}
-	var studentIDs []int64
-	rows, _ := db.Query("SELECT id FROM students WHERE trip_id = $1 AND email = $2", tripID, email)
-	if rows != nil {
-		defer rows.Close()
-		for rows.Next() {
-			var id int64
-			rows.Scan(&id)
-			studentIDs = append(studentIDs, id)
-		}
-	}
-	if len(studentIDs) > 0 {
+	if studentIDs, _ := store.StudentsByEmail(tripID, email); len(studentIDs) > 0 {
 		return "student", studentIDs
 	}
-	rows2, _ := db.Query("SELECT s.id FROM parents p JOIN students s ON s.id = p.student_id WHERE s.trip_id = $1 AND p.email = $2", tripID, email)
-	if rows2 != nil {
-		defer rows2.Close()
-		for rows2.Next() {
-			var id int64
-			rows2.Scan(&id)
-			studentIDs = append(studentIDs, id)
-		}
-	}
-	if len(studentIDs) > 0 {
+	if studentIDs, _ := store.StudentsByParentEmail(tripID, email); len(studentIDs) > 0 {
 		return "parent", studentIDs
 	}
 	return "", nil
 }
 
-func requireTripMember(db *sql.DB, w http.ResponseWriter, r *http.Request) (string, int64, string, []int64, bool) {
-	email, ok := authorize(r)
+func requireTripMember(store Store, w http.ResponseWriter, r *http.Request) (string, int64, string, []int64, bool) {
+	email, ok := authorize(store, r)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return "", 0, "", nil, false
@@ -274,7 +281,7 @@ func requireTripMember(db *sql.DB, w http.ResponseWriter, r *http.Request) (stri
 		http.Error(w, "invalid trip ID", http.StatusBadRequest)
 		return "", 0, "", nil, false
 	}
-	role, studentIDs := tripRole(db, email, tripID)
+	role, studentIDs := tripRole(store, email, tripID)
 	if role == "" {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return "", 0, "", nil, false
@@ -282,93 +289,74 @@ func requireTripMember(db *sql.DB, w http.ResponseWriter, r *http.Request) (stri
 	return email, tripID, role, studentIDs, true
 }
 
-func handleAdminCheck(w http.ResponseWriter, r *http.Request) {
-	email, ok := authorize(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+func handleAdminCheck(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := authorize(store, r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"admin": store.IsGlobalAdmin(email)})
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"admin": isAdmin(email)})
 }
 
-func handleListTrips(db *sql.DB) http.HandlerFunc {
+func handleListTrips(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(w, r); !ok {
-			return
-		}
-		rows, err := db.Query(`
-			SELECT t.id, t.name, t.prefer_not_multiple, t.no_prefer_cost, COALESCE(
-				json_agg(json_build_object('id', ta.id, 'email', ta.email)) FILTER (WHERE ta.id IS NOT NULL),
-				'[]'
-			)
-			FROM trips t
-			LEFT JOIN trip_admins ta ON ta.trip_id = t.id
-			GROUP BY t.id, t.name, t.prefer_not_multiple, t.no_prefer_cost
-			ORDER BY t.id`)
+		if _, ok := requireAdmin(store, w, r); !ok {
+			return
+		}
+		trips, err := store.ListTrips()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		type tripAdmin struct {
-			ID    int64  `json:"id"`
-			Email string `json:"email"`
-		}
-		type trip struct {
-			ID                 int64       `json:"id"`
-			Name               string      `json:"name"`
-			PreferNotMultiple  int         `json:"prefer_not_multiple"`
-			NoPreferCost       int         `json:"no_prefer_cost"`
-			Admins             []tripAdmin `json:"admins"`
-		}
-
-		var trips []trip
-		for rows.Next() {
-			var t trip
-			var adminsJSON string
-			if err := rows.Scan(&t.ID, &t.Name, &t.PreferNotMultiple, &t.NoPreferCost, &adminsJSON); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			json.Unmarshal([]byte(adminsJSON), &t.Admins)
-			trips = append(trips, t)
-		}
 		if trips == nil {
-			trips = []trip{}
+			trips = []tripSummary{}
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(trips)
 	}
 }
 
-func handleCreateTrip(db *sql.DB) http.HandlerFunc {
+func handleCreateTrip(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(w, r); !ok {
+		email, ok := requireAdmin(store, w, r)
+		if !ok {
 			return
 		}
 		var body struct {
-			Name string `json:"name"`
+			Name       string `json:"name"`
+			TemplateID *int64 `json:"template_id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
 			http.Error(w, "name is required", http.StatusBadRequest)
 			return
 		}
-		var id int64
-		err := db.QueryRow("INSERT INTO trips (name) VALUES ($1) RETURNING id", body.Name).Scan(&id)
+		var layout *tripLayout
+		if body.TemplateID != nil {
+			l, err := store.TripTemplate(*body.TemplateID)
+			if err != nil {
+				http.Error(w, "template not found", http.StatusNotFound)
+				return
+			}
+			layout = &l
+		}
+		id, err := store.CreateTrip(body.Name, layout)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: id, Actor: email, Role: "global_admin", Action: "trip.create", After: store.AuditRow("trips", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id, "name": body.Name})
 	}
 }
 
-func handleDeleteTrip(db *sql.DB) http.HandlerFunc {
+func handleDeleteTrip(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(w, r); !ok {
+		email, ok := requireAdmin(store, w, r)
+		if !ok {
 			return
 		}
 		tripID, err := strconv.ParseInt(r.PathValue("tripID"), 10, 64)
@@ -376,22 +364,25 @@ func handleDeleteTrip(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid trip ID", http.StatusBadRequest)
 			return
 		}
-		result, err := db.Exec("DELETE FROM trips WHERE id = $1", tripID)
+		before := store.AuditRow("trips", tripID)
+		deleted, err := store.DeleteTrip(tripID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "trip not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "global_admin", Action: "trip.delete", Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleAddTripAdmin(db *sql.DB) http.HandlerFunc {
+func handleAddTripAdmin(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(w, r); !ok {
+		email, ok := requireAdmin(store, w, r)
+		if !ok {
 			return
 		}
 		tripID, err := strconv.ParseInt(r.PathValue("tripID"), 10, 64)
@@ -406,20 +397,21 @@ func handleAddTripAdmin(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "email is required", http.StatusBadRequest)
 			return
 		}
-		var id int64
-		err = db.QueryRow("INSERT INTO trip_admins (trip_id, email) VALUES ($1, $2) RETURNING id", tripID, body.Email).Scan(&id)
+		id, err := store.AddTripAdmin(tripID, body.Email)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "global_admin", Action: "trip_admin.add", After: store.AuditRow("trip_admins", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id, "email": body.Email})
 	}
 }
 
-func handleRemoveTripAdmin(db *sql.DB) http.HandlerFunc {
+func handleRemoveTripAdmin(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := requireAdmin(w, r); !ok {
+		email, ok := requireAdmin(store, w, r)
+		if !ok {
 			return
 		}
 		adminID, err := strconv.ParseInt(r.PathValue("adminID"), 10, 64)
@@ -427,35 +419,55 @@ func handleRemoveTripAdmin(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid admin ID", http.StatusBadRequest)
 			return
 		}
-		result, err := db.Exec("DELETE FROM trip_admins WHERE id = $1", adminID)
+		before := store.AuditRow("trip_admins", adminID)
+		deleted, err := store.RemoveTripAdmin(adminID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "trip admin not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: before.int64("trip_id"), Actor: email, Role: "global_admin", Action: "trip_admin.remove", Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleTripMe(db *sql.DB) http.HandlerFunc {
+func handleTripMe(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, role, studentIDs, ok := requireTripMember(db, w, r)
+		_, tripID, role, studentIDs, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
 		type studentInfo struct {
-			ID   int64  `json:"id"`
-			Name string `json:"name"`
+			ID     int64             `json:"id"`
+			Name   string            `json:"name"`
+			Window *preferenceWindow `json:"window,omitempty"`
+			Open   bool              `json:"open"`
+		}
+		roster, err := store.ListStudents(tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		var students []studentInfo
 		for _, sid := range studentIDs {
-			var name string
-			if err := db.QueryRow("SELECT name FROM students WHERE id = $1 AND trip_id = $2", sid, tripID).Scan(&name); err == nil {
-				students = append(students, studentInfo{ID: sid, Name: name})
+			i := slices.IndexFunc(roster, func(s studentRecord) bool { return s.ID == sid })
+			if i < 0 {
+				continue
+			}
+			info := studentInfo{ID: sid, Name: roster[i].Name, Open: true}
+			if role != "admin" {
+				pw, err := store.PreferenceWindow(tripID, role, sid)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				info.Window = &pw
+				info.Open = pw.open(time.Now())
 			}
+			students = append(students, info)
 		}
 		if students == nil {
 			students = []studentInfo{}
@@ -465,108 +477,58 @@ func handleTripMe(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func handleGetTrip(db *sql.DB) http.HandlerFunc {
+func handleGetTrip(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, _, _, ok := requireTripMember(db, w, r)
+		_, tripID, _, _, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
-		var name string
-		var preferNotMultiple, noPreferCost int
-		err := db.QueryRow("SELECT name, prefer_not_multiple, no_prefer_cost FROM trips WHERE id = $1", tripID).Scan(&name, &preferNotMultiple, &noPreferCost)
+		trip, err := store.Trip(tripID)
 		if err != nil {
 			http.Error(w, "trip not found", http.StatusNotFound)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"id": tripID, "name": name, "prefer_not_multiple": preferNotMultiple, "no_prefer_cost": noPreferCost})
+		json.NewEncoder(w).Encode(trip)
 	}
 }
 
-func handleListStudents(db *sql.DB) http.HandlerFunc {
+func handleListStudents(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, role, _, ok := requireTripMember(db, w, r)
+		_, tripID, role, _, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
 
+		students, err := store.ListStudents(tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		if role != "admin" {
-			rows, err := db.Query("SELECT id, name FROM students WHERE trip_id = $1 ORDER BY name", tripID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			defer rows.Close()
 			type studentBasic struct {
 				ID   int64  `json:"id"`
 				Name string `json:"name"`
 			}
-			var students []studentBasic
-			for rows.Next() {
-				var s studentBasic
-				if err := rows.Scan(&s.ID, &s.Name); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				students = append(students, s)
-			}
-			if students == nil {
-				students = []studentBasic{}
+			basics := []studentBasic{}
+			for _, s := range students {
+				basics = append(basics, studentBasic{s.ID, s.Name})
 			}
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(students)
+			json.NewEncoder(w).Encode(basics)
 			return
 		}
-
-		rows, err := db.Query(`
-			SELECT s.id, s.name, s.email, COALESCE(
-				json_agg(json_build_object('id', p.id, 'email', p.email)) FILTER (WHERE p.id IS NOT NULL),
-				'[]'
-			)
-			FROM students s
-			LEFT JOIN parents p ON p.student_id = s.id
-			WHERE s.trip_id = $1
-			GROUP BY s.id, s.name, s.email
-			ORDER BY s.name`, tripID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-
-		type parent struct {
-			ID    int64  `json:"id"`
-			Email string `json:"email"`
-		}
-		type student struct {
-			ID      int64    `json:"id"`
-			Name    string   `json:"name"`
-			Email   string   `json:"email"`
-			Parents []parent `json:"parents"`
-		}
-
-		var students []student
-		for rows.Next() {
-			var s student
-			var parentsJSON string
-			if err := rows.Scan(&s.ID, &s.Name, &s.Email, &parentsJSON); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			json.Unmarshal([]byte(parentsJSON), &s.Parents)
-			students = append(students, s)
-		}
 		if students == nil {
-			students = []student{}
+			students = []studentRecord{}
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(students)
 	}
 }
 
-func handleCreateStudent(db *sql.DB) http.HandlerFunc {
+func handleCreateStudent(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
@@ -578,20 +540,20 @@ func handleCreateStudent(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "name and email are required", http.StatusBadRequest)
 			return
 		}
-		var id int64
-		err := db.QueryRow("INSERT INTO students (trip_id, name, email) VALUES ($1, $2, $3) RETURNING id", tripID, body.Name, body.Email).Scan(&id)
+		id, err := store.CreateStudent(tripID, body.Name, body.Email)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "student.create", StudentIDs: []int64{id}, After: store.AuditRow("students", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id, "name": body.Name, "email": body.Email})
 	}
 }
 
-func handleDeleteStudent(db *sql.DB) http.HandlerFunc {
+func handleDeleteStudent(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
@@ -600,22 +562,24 @@ func handleDeleteStudent(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid student ID", http.StatusBadRequest)
 			return
 		}
-		result, err := db.Exec("DELETE FROM students WHERE id = $1 AND trip_id = $2", studentID, tripID)
+		before := store.AuditRow("students", studentID)
+		deleted, err := store.DeleteStudent(tripID, studentID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "student not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "student.delete", StudentIDs: []int64{studentID}, Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleAddParent(db *sql.DB) http.HandlerFunc {
+func handleAddParent(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
@@ -631,21 +595,20 @@ func handleAddParent(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "email is required", http.StatusBadRequest)
 			return
 		}
-		var id int64
-		err = db.QueryRow("INSERT INTO parents (student_id, email) VALUES ((SELECT id FROM students WHERE id = $1 AND trip_id = $2), $3) RETURNING id",
-			studentID, tripID, body.Email).Scan(&id)
+		id, err := store.AddParent(tripID, studentID, body.Email)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "parent.add", StudentIDs: []int64{studentID}, After: store.AuditRow("parents", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id, "email": body.Email})
 	}
 }
 
-func handleRemoveParent(db *sql.DB) http.HandlerFunc {
+func handleRemoveParent(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
@@ -654,28 +617,41 @@ func handleRemoveParent(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid parent ID", http.StatusBadRequest)
 			return
 		}
-		result, err := db.Exec(`DELETE FROM parents WHERE id = $1 AND student_id IN (SELECT id FROM students WHERE trip_id = $2)`, parentID, tripID)
+		before := store.AuditRow("parents", parentID)
+		deleted, err := store.RemoveParent(tripID, parentID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "parent not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "parent.remove", StudentIDs: []int64{before.int64("student_id")}, Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleUpdateTrip(db *sql.DB) http.HandlerFunc {
+func handleUpdateTrip(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
 		var body struct {
-			PreferNotMultiple *int `json:"prefer_not_multiple"`
-			NoPreferCost      *int `json:"no_prefer_cost"`
+			PreferNotMultiple *int    `json:"prefer_not_multiple"`
+			NoPreferCost      *int    `json:"no_prefer_cost"`
+			RankWeights       []int64 `json:"rank_weights"`
+			Objective         *string `json:"objective"`
+			FairnessWeight    *int    `json:"fairness_weight"`
+			SingletonCost     *int    `json:"singleton_cost"`
+			MinOccupancy      *int    `json:"min_occupancy"`
+			UnderfillCost     *int    `json:"underfill_cost"`
+			ImbalanceCost     *int    `json:"imbalance_cost"`
+			StudentOpensAt    *string `json:"student_opens_at"`
+			StudentClosesAt   *string `json:"student_closes_at"`
+			ParentOpensAt     *string `json:"parent_opens_at"`
+			ParentClosesAt    *string `json:"parent_closes_at"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -693,85 +669,103 @@ func handleUpdateTrip(db *sql.DB) http.HandlerFunc {
 				return
 			}
 		}
-		if body.PreferNotMultiple != nil {
-			if _, err := db.Exec("UPDATE trips SET prefer_not_multiple = $1 WHERE id = $2", *body.PreferNotMultiple, tripID); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		if body.RankWeights != nil {
+			if len(body.RankWeights) < 1 || len(body.RankWeights) > maxRanks {
+				http.Error(w, "rank_weights must have between 1 and "+strconv.Itoa(maxRanks)+" entries", http.StatusBadRequest)
 				return
 			}
+			for _, weight := range body.RankWeights {
+				if weight < 1 {
+					http.Error(w, "rank_weights must each be at least 1", http.StatusBadRequest)
+					return
+				}
+			}
 		}
-		if body.NoPreferCost != nil {
-			if _, err := db.Exec("UPDATE trips SET no_prefer_cost = $1 WHERE id = $2", *body.NoPreferCost, tripID); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		if body.Objective != nil && !slices.Contains(solver.Objectives, *body.Objective) {
+			http.Error(w, "objective must be one of "+strings.Join(solver.Objectives, ", "), http.StatusBadRequest)
+			return
+		}
+		if body.FairnessWeight != nil && *body.FairnessWeight < 0 {
+			http.Error(w, "fairness_weight must be at least 0", http.StatusBadRequest)
+			return
+		}
+		fillCosts := []struct {
+			column string
+			value  *int
+		}{
+			{"singleton_cost", body.SingletonCost},
+			{"min_occupancy", body.MinOccupancy},
+			{"underfill_cost", body.UnderfillCost},
+			{"imbalance_cost", body.ImbalanceCost},
+		}
+		for _, fc := range fillCosts {
+			if fc.value != nil && *fc.value < 0 {
+				http.Error(w, fc.column+" must be at least 0", http.StatusBadRequest)
 				return
 			}
 		}
+		windows := []struct {
+			column string
+			value  *string
+		}{
+			{"student_opens_at", body.StudentOpensAt},
+			{"student_closes_at", body.StudentClosesAt},
+			{"parent_opens_at", body.ParentOpensAt},
+			{"parent_closes_at", body.ParentClosesAt},
+		}
+		update := tripUpdate{
+			PreferNotMultiple: body.PreferNotMultiple, NoPreferCost: body.NoPreferCost, RankWeights: body.RankWeights,
+			Objective: body.Objective, FairnessWeight: body.FairnessWeight,
+			SingletonCost: body.SingletonCost, MinOccupancy: body.MinOccupancy, UnderfillCost: body.UnderfillCost, ImbalanceCost: body.ImbalanceCost,
+			Windows: map[string]*time.Time{},
+		}
+		for _, win := range windows {
+			if win.value == nil {
+				continue
+			}
+			if *win.value == "" {
+				update.Windows[win.column] = nil
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, *win.value)
+			if err != nil {
+				http.Error(w, win.column+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			update.Windows[win.column] = &t
+		}
+		before := store.AuditRow("trips", tripID)
+		if err := store.UpdateTrip(tripID, update); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "trip.update", Before: before, After: store.AuditRow("trips", tripID)})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleListConstraints(db *sql.DB) http.HandlerFunc {
+func handleListConstraints(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, role, myStudentIDs, ok := requireTripMember(db, w, r)
+		_, tripID, role, myStudentIDs, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
-		var query string
-		var args []any
-		switch role {
-		case "admin":
-			query = `SELECT rc.id, rc.student_a_id, sa.name, rc.student_b_id, sb.name, rc.kind::text, rc.level::text
-				FROM roommate_constraints rc
-				JOIN students sa ON sa.id = rc.student_a_id
-				JOIN students sb ON sb.id = rc.student_b_id
-				WHERE sa.trip_id = $1
-				ORDER BY rc.id`
-			args = []any{tripID}
-		case "student":
-			query = `SELECT rc.id, rc.student_a_id, sa.name, rc.student_b_id, sb.name, rc.kind::text, rc.level::text
-				FROM roommate_constraints rc
-				JOIN students sa ON sa.id = rc.student_a_id
-				JOIN students sb ON sb.id = rc.student_b_id
-				WHERE sa.trip_id = $1 AND rc.level = 'student' AND rc.student_a_id = ANY($2)
-				ORDER BY rc.id`
-			args = []any{tripID, pq.Array(myStudentIDs)}
-		case "parent":
-			query = `SELECT rc.id, rc.student_a_id, sa.name, rc.student_b_id, sb.name, rc.kind::text, rc.level::text
-				FROM roommate_constraints rc
-				JOIN students sa ON sa.id = rc.student_a_id
-				JOIN students sb ON sb.id = rc.student_b_id
-				WHERE sa.trip_id = $1 AND rc.level = 'parent' AND rc.student_a_id = ANY($2)
-				ORDER BY rc.id`
-			args = []any{tripID, pq.Array(myStudentIDs)}
-		}
-		rows, err := db.Query(query, args...)
+		level := role
+		if role == "admin" {
+			level = ""
+		}
+		records, err := store.ListConstraints(tripID, level, myStudentIDs)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
 		type constraint struct {
-			ID           int64   `json:"id"`
-			StudentAID   int64   `json:"student_a_id"`
-			StudentAName string  `json:"student_a_name"`
-			StudentBID   int64   `json:"student_b_id"`
-			StudentBName string  `json:"student_b_name"`
-			Kind         string  `json:"kind"`
-			Level        string  `json:"level"`
-			Override     *string `json:"override"`
-		}
-
-		var constraints []constraint
-		for rows.Next() {
-			var c constraint
-			if err := rows.Scan(&c.ID, &c.StudentAID, &c.StudentAName, &c.StudentBID, &c.StudentBName, &c.Kind, &c.Level); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			constraints = append(constraints, c)
+			constraintRecord
+			Override *string `json:"override"`
 		}
-		if constraints == nil {
-			constraints = []constraint{}
+		constraints := []constraint{}
+		for _, c := range records {
+			constraints = append(constraints, constraint{constraintRecord: c})
 		}
 
 		type levelKind struct {
@@ -790,6 +784,8 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 			StudentBName string `json:"student_b_name"`
 			Kind         string `json:"kind"`
 			Level        string `json:"level"`
+			Rank         *int   `json:"rank"`
+			Weight       int    `json:"weight"`
 		}
 		var overalls []overallEntry
 		type mismatchEntry struct {
@@ -808,6 +804,11 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 		var oversizedGroups [][]string
 
 		if role == "admin" {
+			trip, err := store.Trip(tripID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			type pairKey struct{ a, b int64 }
 			pairGroups := map[pairKey][]int{}
 			for i := range constraints {
@@ -830,6 +831,8 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 					StudentBName: constraints[bestIdx].StudentBName,
 					Kind:         constraints[bestIdx].Kind,
 					Level:        constraints[bestIdx].Level,
+					Rank:         constraints[bestIdx].Rank,
+					Weight:       rankWeight(trip.RankWeights, constraints[bestIdx].Rank),
 				})
 
 				var posIdx, negIdx []int
@@ -889,23 +892,16 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 				}
 			}
 
-			sRows, err := db.Query("SELECT id, name FROM students WHERE trip_id = $1", tripID)
+			students, err := store.ListStudents(tripID)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			defer sRows.Close()
 			studentName := map[int64]string{}
 			var studentIDs []int64
-			for sRows.Next() {
-				var id int64
-				var name string
-				if err := sRows.Scan(&id, &name); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				studentName[id] = name
-				studentIDs = append(studentIDs, id)
+			for _, s := range students {
+				studentName[s.ID] = s.Name
+				studentIDs = append(studentIDs, s.ID)
 			}
 
 			mustAdj := map[int64][]int64{}
@@ -982,8 +978,7 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 				hardConflicts = append(hardConflicts, chain)
 			}
 
-			var maxRoomSize int
-			db.QueryRow("SELECT COALESCE(MAX(size), 0) FROM room_groups WHERE trip_id = $1", tripID).Scan(&maxRoomSize)
+			maxRoomSize, _ := store.MaxRoomCapacity(tripID)
 			mustGroups := map[int64][]string{}
 			for _, id := range studentIDs {
 				root := ufFind(id)
@@ -1018,9 +1013,9 @@ func handleListConstraints(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func handleCreateConstraint(db *sql.DB) http.HandlerFunc {
+func handleCreateConstraint(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, role, myStudentIDs, ok := requireTripMember(db, w, r)
+		email, tripID, role, myStudentIDs, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
@@ -1029,6 +1024,7 @@ func handleCreateConstraint(db *sql.DB) http.HandlerFunc {
 			StudentBID int64  `json:"student_b_id"`
 			Kind       string `json:"kind"`
 			Level      string `json:"level"`
+			Rank       *int   `json:"rank"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -1047,6 +1043,21 @@ func handleCreateConstraint(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid kind for level", http.StatusBadRequest)
 			return
 		}
+		if body.Rank != nil {
+			if body.Kind != "prefer" {
+				http.Error(w, "rank only applies to prefer", http.StatusBadRequest)
+				return
+			}
+			trip, err := store.Trip(tripID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if *body.Rank < 1 || *body.Rank > len(trip.RankWeights) {
+				http.Error(w, "rank must be between 1 and "+strconv.Itoa(len(trip.RankWeights)), http.StatusBadRequest)
+				return
+			}
+		}
 		if role != "admin" {
 			if body.Level != role {
 				http.Error(w, "forbidden", http.StatusForbidden)
@@ -1056,28 +1067,31 @@ func handleCreateConstraint(db *sql.DB) http.HandlerFunc {
 				http.Error(w, "forbidden", http.StatusForbidden)
 				return
 			}
+			if !requirePreferenceWindow(store, w, tripID, role, body.StudentAID) {
+				return
+			}
 		}
-		var id int64
-		err := db.QueryRow(`
-			INSERT INTO roommate_constraints (student_a_id, student_b_id, kind, level)
-			SELECT $1, $2, $3::constraint_kind, $4::constraint_level
-			FROM students sa
-			JOIN students sb ON sb.id = $2 AND sb.trip_id = $5
-			WHERE sa.id = $1 AND sa.trip_id = $5
-			ON CONFLICT (student_a_id, student_b_id, level) DO UPDATE SET kind = EXCLUDED.kind
-			RETURNING id`, body.StudentAID, body.StudentBID, body.Kind, body.Level, tripID).Scan(&id)
+		var before auditRow
+		if beforeID, ok := store.FindConstraint(body.StudentAID, body.StudentBID, body.Level); ok {
+			before = store.AuditRow("roommate_constraints", beforeID)
+		}
+		id, err := store.SetConstraint(tripID, constraintRecord{
+			StudentAID: body.StudentAID, StudentBID: body.StudentBID, Kind: body.Kind, Level: body.Level, Rank: body.Rank,
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: role, Action: "constraint.set", StudentIDs: []int64{body.StudentAID, body.StudentBID},
+			Before: before, After: store.AuditRow("roommate_constraints", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id})
 	}
 }
 
-func handleDeleteConstraint(db *sql.DB) http.HandlerFunc {
+func handleDeleteConstraint(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, role, myStudentIDs, ok := requireTripMember(db, w, r)
+		email, tripID, role, myStudentIDs, ok := requireTripMember(store, w, r)
 		if !ok {
 			return
 		}
@@ -1086,73 +1100,62 @@ func handleDeleteConstraint(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid constraint ID", http.StatusBadRequest)
 			return
 		}
-		var query string
-		var args []any
+		level := role
 		if role == "admin" {
-			query = `DELETE FROM roommate_constraints WHERE id = $1
-				AND student_a_id IN (SELECT id FROM students WHERE trip_id = $2)`
-			args = []any{constraintID, tripID}
-		} else {
-			query = `DELETE FROM roommate_constraints WHERE id = $1
-				AND student_a_id = ANY($2) AND level = $3::constraint_level`
-			args = []any{constraintID, pq.Array(myStudentIDs), role}
-		}
-		result, err := db.Exec(query, args...)
+			level = ""
+		}
+		before := store.AuditRow("roommate_constraints", constraintID)
+		if studentAID := before.int64("student_a_id"); role != "admin" && slices.Contains(myStudentIDs, studentAID) {
+			if !requirePreferenceWindow(store, w, tripID, role, studentAID) {
+				return
+			}
+		}
+		deleted, err := store.DeleteConstraint(tripID, constraintID, level, myStudentIDs)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "constraint not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: role, Action: "constraint.delete",
+			StudentIDs: []int64{before.int64("student_a_id"), before.int64("student_b_id")}, Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleListRoomGroups(db *sql.DB) http.HandlerFunc {
+func handleListRoomGroups(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		_, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
-		rows, err := db.Query("SELECT id, size, count FROM room_groups WHERE trip_id = $1 ORDER BY id", tripID)
+		groups, err := store.ListRoomGroups(tripID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-		type roomGroup struct {
-			ID    int64 `json:"id"`
-			Size  int   `json:"size"`
-			Count int   `json:"count"`
-		}
-		var groups []roomGroup
-		for rows.Next() {
-			var g roomGroup
-			if err := rows.Scan(&g.ID, &g.Size, &g.Count); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			groups = append(groups, g)
-		}
 		if groups == nil {
-			groups = []roomGroup{}
+			groups = []roomGroupRecord{}
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(groups)
 	}
 }
 
-func handleCreateRoomGroup(db *sql.DB) http.HandlerFunc {
+func handleCreateRoomGroup(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
 		var body struct {
-			Size  int `json:"size"`
-			Count int `json:"count"`
+			Size        int    `json:"size"`
+			Count       int    `json:"count"`
+			Building    string `json:"building"`
+			Floor       string `json:"floor"`
+			StartNumber *int   `json:"start_number"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -1162,20 +1165,22 @@ func handleCreateRoomGroup(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "size and count must be at least 1", http.StatusBadRequest)
 			return
 		}
-		var id int64
-		err := db.QueryRow("INSERT INTO room_groups (trip_id, size, count) VALUES ($1, $2, $3) RETURNING id", tripID, body.Size, body.Count).Scan(&id)
+		id, err := store.CreateRoomGroup(tripID, newRoomGroup{
+			Size: body.Size, Count: body.Count, Building: body.Building, Floor: body.Floor, StartNumber: body.StartNumber,
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "room_group.create", After: store.AuditRow("room_groups", id)})
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{"id": id, "size": body.Size, "count": body.Count})
 	}
 }
 
-func handleDeleteRoomGroup(db *sql.DB) http.HandlerFunc {
+func handleDeleteRoomGroup(store Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
+		email, tripID, ok := requireTripAdmin(store, w, r)
 		if !ok {
 			return
 		}
@@ -1184,187 +1189,293 @@ func handleDeleteRoomGroup(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "invalid group ID", http.StatusBadRequest)
 			return
 		}
-		result, err := db.Exec("DELETE FROM room_groups WHERE id = $1 AND trip_id = $2", groupID, tripID)
+		before := store.AuditRow("room_groups", groupID)
+		deleted, err := store.DeleteRoomGroup(tripID, groupID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n, _ := result.RowsAffected(); n == 0 {
+		if !deleted {
 			http.Error(w, "room group not found", http.StatusNotFound)
 			return
 		}
+		store.RecordAudit(auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "room_group.delete", Before: before})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func handleSolve(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		_, tripID, ok := requireTripAdmin(db, w, r)
-		if !ok {
-			return
-		}
+type solveInput struct {
+	studentIDs  []int64
+	studentName map[int64]string
+	rooms       []roomInfo
+	problem     solver.Problem
+}
 
-		var pnMultiple, npCost int
-		err := db.QueryRow("SELECT prefer_not_multiple, no_prefer_cost FROM trips WHERE id = $1", tripID).Scan(&pnMultiple, &npCost)
-		if err != nil {
-			http.Error(w, "trip not found", http.StatusNotFound)
-			return
-		}
+func loadSolveInput(db *sql.DB, w http.ResponseWriter, tripID int64) (*solveInput, bool) {
+	in := &solveInput{studentName: map[int64]string{}}
+	p := &in.problem
+	var rankWeights []int64
+	err := db.QueryRow(`
+		SELECT prefer_not_multiple, no_prefer_cost, rank_weights, objective, fairness_weight,
+			singleton_cost, min_occupancy, underfill_cost, imbalance_cost
+		FROM trips WHERE id = $1`, tripID).Scan(
+		&p.PreferNotMultiple, &p.NoPreferCost, pq.Array(&rankWeights), &p.Objective, &p.FairnessWeight,
+		&p.SingletonCost, &p.MinOccupancy, &p.UnderfillCost, &p.ImbalanceCost)
+	if err != nil {
+		http.Error(w, "trip not found", http.StatusNotFound)
+		return nil, false
+	}
 
-		rgRows, err := db.Query("SELECT size, count FROM room_groups WHERE trip_id = $1 ORDER BY id", tripID)
-		if err != nil {
+	in.rooms, err = loadTripRooms(db, tripID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	roomIdx := map[int64]int{}
+	for i, room := range in.rooms {
+		p.RoomSizes = append(p.RoomSizes, room.Capacity)
+		roomIdx[room.ID] = i
+	}
+	if len(p.RoomSizes) == 0 {
+		http.Error(w, "no room groups configured", http.StatusBadRequest)
+		return nil, false
+	}
+
+	rows, err := db.Query("SELECT id, name FROM students WHERE trip_id = $1 ORDER BY id", tripID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer rgRows.Close()
-		var roomSizes []int
-		for rgRows.Next() {
-			var size, count int
-			if err := rgRows.Scan(&size, &count); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			for range count {
-				roomSizes = append(roomSizes, size)
-			}
-		}
-		if len(roomSizes) == 0 {
-			http.Error(w, "no room groups configured", http.StatusBadRequest)
-			return
+			return nil, false
 		}
+		in.studentIDs = append(in.studentIDs, id)
+		in.studentName[id] = name
+	}
 
-		rows, err := db.Query("SELECT id, name FROM students WHERE trip_id = $1 ORDER BY id", tripID)
-		if err != nil {
+	crows, err := db.Query(`
+		SELECT rc.student_a_id, rc.student_b_id, rc.kind::text, rc.level::text, rc.rank
+		FROM roommate_constraints rc
+		JOIN students sa ON sa.id = rc.student_a_id
+		WHERE sa.trip_id = $1`, tripID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	defer crows.Close()
+
+	type dbConstraint struct {
+		aID, bID    int64
+		kind, level string
+		rank        *int
+	}
+	var allConstraints []dbConstraint
+	for crows.Next() {
+		var c dbConstraint
+		if err := crows.Scan(&c.aID, &c.bID, &c.kind, &c.level, &c.rank); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, false
 		}
-		defer rows.Close()
-		var studentIDs []int64
-		studentName := map[int64]string{}
-		for rows.Next() {
-			var id int64
-			var name string
-			if err := rows.Scan(&id, &name); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+		allConstraints = append(allConstraints, c)
+	}
+
+	type pairKey struct{ a, b int64 }
+	byPair := map[pairKey]map[string]dbConstraint{}
+	for _, c := range allConstraints {
+		pk := pairKey{c.aID, c.bID}
+		if byPair[pk] == nil {
+			byPair[pk] = map[string]dbConstraint{}
+		}
+		byPair[pk][c.level] = c
+	}
+	levelPriority := []string{"admin", "parent", "student"}
+	overalls := map[pairKey]dbConstraint{}
+	for pk, levels := range byPair {
+		for _, lev := range levelPriority {
+			if c, ok := levels[lev]; ok {
+				overalls[pk] = c
+				break
 			}
-			studentIDs = append(studentIDs, id)
-			studentName[id] = name
 		}
+	}
 
-		if len(studentIDs) == 0 {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]any{"solutions": []any{}})
-			return
-		}
+	idx := map[int64]int{}
+	for i, id := range in.studentIDs {
+		idx[id] = i
+	}
 
-		crows, err := db.Query(`
-			SELECT rc.student_a_id, rc.student_b_id, rc.kind::text, rc.level::text
-			FROM roommate_constraints rc
-			JOIN students sa ON sa.id = rc.student_a_id
-			WHERE sa.trip_id = $1`, tripID)
-		if err != nil {
+	p.N = len(in.studentIDs)
+	for pk, c := range overalls {
+		p.Constraints = append(p.Constraints, solver.Constraint{
+			StudentA: idx[pk.a],
+			StudentB: idx[pk.b],
+			Kind:     c.kind,
+			Weight:   rankWeight(rankWeights, c.rank),
+		})
+	}
+
+	prows, err := db.Query(`
+		SELECT ps.student_id, ps.room_id
+		FROM pinned_students ps
+		JOIN students s ON s.id = ps.student_id
+		WHERE s.trip_id = $1`, tripID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	defer prows.Close()
+	p.Pinned = map[int]int{}
+	for prows.Next() {
+		var studentID, roomID int64
+		if err := prows.Scan(&studentID, &roomID); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, false
 		}
-		defer crows.Close()
+		p.Pinned[idx[studentID]] = roomIdx[roomID]
+	}
+
+	p.Eligible, err = loadEligibility(db, tripID, in.studentIDs, in.rooms)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return in, true
+}
+
+type roomMember struct {
+	ID          int64              `json:"id"`
+	Name        string             `json:"name"`
+	Explanation *memberExplanation `json:"explanation,omitempty"`
+}
+
+type memberExplanation struct {
+	Score              int          `json:"score"`
+	PrefersSatisfied   []roomMember `json:"prefers_satisfied"`
+	PrefersUnsatisfied []roomMember `json:"prefers_unsatisfied"`
+	PreferNotsViolated []roomMember `json:"prefer_nots_violated"`
+	NoPreferPenalty    bool         `json:"no_prefer_penalty"`
+}
+
+type solutionRoom struct {
+	roomInfo
+	Members     []roomMember `json:"members"`
+	Score       *int         `json:"score,omitempty"`
+	FillPenalty int          `json:"fill_penalty,omitempty"`
+}
 
-		type dbConstraint struct {
-			aID, bID    int64
-			kind, level string
+type solutionResult struct {
+	Rooms []solutionRoom `json:"rooms"`
+	Score int            `json:"score"`
+	Worst *int           `json:"worst,omitempty"`
+}
+
+func solutionResults(in *solveInput, solutions []solver.Solution) []solutionResult {
+	results := []solutionResult{}
+	toMembers := func(idxs []int) []roomMember {
+		list := []roomMember{}
+		for _, i := range idxs {
+			sid := in.studentIDs[i]
+			list = append(list, roomMember{ID: sid, Name: in.studentName[sid]})
 		}
-		var allConstraints []dbConstraint
-		for crows.Next() {
-			var c dbConstraint
-			if err := crows.Scan(&c.aID, &c.bID, &c.kind, &c.level); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+		return list
+	}
+	for _, sol := range solutions {
+		ex := in.problem.Explain(sol.Assignment)
+		roomMap := map[int][]roomMember{}
+		for i, room := range sol.Assignment {
+			sid := in.studentIDs[i]
+			st := ex.Students[i]
+			roomMap[room] = append(roomMap[room], roomMember{ID: sid, Name: in.studentName[sid], Explanation: &memberExplanation{
+				Score:              st.Score,
+				PrefersSatisfied:   toMembers(st.PrefersSatisfied),
+				PrefersUnsatisfied: toMembers(st.PrefersUnsatisfied),
+				PreferNotsViolated: toMembers(st.PreferNotsViolated),
+				NoPreferPenalty:    st.NoPreferPenalty,
+			}})
+		}
+		var rooms []solutionRoom
+		for room, info := range in.rooms {
+			if members, ok := roomMap[room]; ok {
+				slices.SortFunc(members, func(a, b roomMember) int { return strings.Compare(a.Name, b.Name) })
+				rooms = append(rooms, solutionRoom{roomInfo: info, Members: members, Score: &ex.Rooms[room].Score, FillPenalty: ex.Rooms[room].FillPenalty})
 			}
-			allConstraints = append(allConstraints, c)
 		}
-
-		type pairKey struct{ a, b int64 }
-		byPair := map[pairKey]map[string]string{}
-		for _, c := range allConstraints {
-			pk := pairKey{c.aID, c.bID}
-			if byPair[pk] == nil {
-				byPair[pk] = map[string]string{}
-			}
-			byPair[pk][c.level] = c.kind
-		}
-		levelPriority := []string{"admin", "parent", "student"}
-		overalls := map[pairKey]string{}
-		for pk, levels := range byPair {
-			for _, lev := range levelPriority {
-				if kind, ok := levels[lev]; ok {
-					overalls[pk] = kind
-					break
+		worst := ex.Students[0].Score
+		for _, st := range ex.Students {
+			worst = min(worst, st.Score)
+		}
+		results = append(results, solutionResult{Rooms: rooms, Score: sol.Score, Worst: &worst})
+	}
+	slices.SortFunc(results, func(a, b solutionResult) int {
+		for i := range min(len(a.Rooms), len(b.Rooms)) {
+			for j := range min(len(a.Rooms[i].Members), len(b.Rooms[i].Members)) {
+				if c := strings.Compare(a.Rooms[i].Members[j].Name, b.Rooms[i].Members[j].Name); c != 0 {
+					return c
 				}
 			}
 		}
+		return 0
+	})
+	return results
+}
 
-		idx := map[int64]int{}
-		for i, id := range studentIDs {
-			idx[id] = i
+func handleSolve(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
 		}
-		n := len(studentIDs)
 
-		var constraints []solver.Constraint
-		for pk, kind := range overalls {
-			constraints = append(constraints, solver.Constraint{
-				StudentA: idx[pk.a],
-				StudentB: idx[pk.b],
-				Kind:     kind,
-			})
+		var body struct {
+			Backend   string `json:"backend"`
+			TimeLimit *int   `json:"time_limit"`
 		}
-
-		rng := rand.New(rand.NewSource(42))
-		solutions := solver.SolveFast(n, roomSizes, pnMultiple, npCost, constraints, solver.DefaultParams, rng)
-
-		if solutions == nil {
-			http.Error(w, "hard conflicts exist, resolve before solving", http.StatusBadRequest)
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Longer or exact solves run as jobs so they neither outlive proxy
+		// timeouts nor bypass the job limits.
+		if (body.Backend != "" && body.Backend != "fast") || body.TimeLimit != nil {
+			http.Error(w, "backend and time_limit need a solve job", http.StatusBadRequest)
+			return
+		}
+		backend, err := newSolveBackend(body.Backend, solver.DefaultParams, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		numRooms := len(roomSizes)
-
-		type roomMember struct {
-			ID   int64  `json:"id"`
-			Name string `json:"name"`
+		in, ok := loadSolveInput(db, w, tripID)
+		if !ok {
+			return
 		}
-		type solutionResult struct {
-			Rooms [][]roomMember `json:"rooms"`
-			Score int            `json:"score"`
+		if len(in.studentIDs) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"solutions": []any{}})
+			return
+		}
+		if !requireFeasible(w, in) {
+			return
+		}
+
+		result, err := backend.solve(r.Context(), in, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		var results []solutionResult
-		for _, sol := range solutions {
-			roomMap := map[int][]roomMember{}
-			for i, room := range sol.Assignment {
-				sid := studentIDs[i]
-				roomMap[room] = append(roomMap[room], roomMember{ID: sid, Name: studentName[sid]})
-			}
-			var rooms [][]roomMember
-			for room := range numRooms {
-				if members, ok := roomMap[room]; ok {
-					slices.SortFunc(members, func(a, b roomMember) int { return strings.Compare(a.Name, b.Name) })
-					rooms = append(rooms, members)
-				}
-			}
-			slices.SortFunc(rooms, func(a, b []roomMember) int { return strings.Compare(a[0].Name, b[0].Name) })
-			results = append(results, solutionResult{Rooms: rooms, Score: sol.Score})
-		}
-		slices.SortFunc(results, func(a, b solutionResult) int {
-			for i := range min(len(a.Rooms), len(b.Rooms)) {
-				for j := range min(len(a.Rooms[i]), len(b.Rooms[i])) {
-					if c := strings.Compare(a.Rooms[i][j].Name, b.Rooms[i][j].Name); c != 0 {
-						return c
-					}
-				}
-			}
-			return 0
-		})
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"solutions": results})
+		json.NewEncoder(w).Encode(map[string]any{
+			"solutions": solutionResults(in, result.Solutions),
+			"optimal":   result.Optimal,
+			"bound":     result.Bound,
+			"stats":     newSolveStats(result.Stats),
+		})
 	}
 }
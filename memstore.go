@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryStore is an in-process Store for tests. Rows keep their column names
+// as JSON tags so audit snapshots look like the ones Postgres produces, and
+// deletes cascade the way the foreign keys do.
+type memoryStore struct {
+	mu           sync.Mutex
+	nextID       int64
+	sessions     map[string]memSession
+	globalAdmins map[string]bool
+	templates    map[int64]tripLayout
+	trips        []*tripRecord
+	tripAdmins   []*memTripAdmin
+	students     []*memStudent
+	parents      []*memParent
+	attributes   map[int64]map[string]string
+	constraints  []*memConstraint
+	extensions   []*memWindowExtension
+	roomGroups   []*memRoomGroup
+	rooms        []*memRoom
+	audit        []auditEntry
+}
+
+type memSession struct {
+	email         string
+	lastSeen      time.Time
+	expiresAt     time.Time
+	idleExpiresAt time.Time
+	revoked       bool
+}
+
+type memTripAdmin struct {
+	ID     int64  `json:"id"`
+	TripID int64  `json:"trip_id"`
+	Email  string `json:"email"`
+}
+
+type memStudent struct {
+	ID     int64  `json:"id"`
+	TripID int64  `json:"trip_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+type memParent struct {
+	ID        int64  `json:"id"`
+	StudentID int64  `json:"student_id"`
+	Email     string `json:"email"`
+}
+
+type memConstraint struct {
+	ID         int64  `json:"id"`
+	StudentAID int64  `json:"student_a_id"`
+	StudentBID int64  `json:"student_b_id"`
+	Kind       string `json:"kind"`
+	Level      string `json:"level"`
+	Rank       *int   `json:"rank"`
+}
+
+type memWindowExtension struct {
+	ID        int64     `json:"id"`
+	StudentID int64     `json:"student_id"`
+	Level     string    `json:"level"`
+	ClosesAt  time.Time `json:"closes_at"`
+	GrantedBy string    `json:"granted_by"`
+}
+
+type memRoomGroup struct {
+	ID     int64 `json:"id"`
+	TripID int64 `json:"trip_id"`
+	Size   int   `json:"size"`
+	Count  int   `json:"count"`
+}
+
+type memRoom struct {
+	ID          int64  `json:"id"`
+	RoomGroupID int64  `json:"room_group_id"`
+	Name        string `json:"name"`
+	Floor       string `json:"floor"`
+	Building    string `json:"building"`
+	Capacity    int    `json:"capacity"`
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		sessions:     map[string]memSession{},
+		globalAdmins: map[string]bool{},
+		templates:    map[int64]tripLayout{},
+		attributes:   map[int64]map[string]string{},
+	}
+}
+
+func (s *memoryStore) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *memoryStore) CreateSession(id, email string, issuedAt, expiresAt, idleExpiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = memSession{email: email, lastSeen: issuedAt, expiresAt: expiresAt, idleExpiresAt: idleExpiresAt}
+	return nil
+}
+
+func (s *memoryStore) ActiveSession(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	now := time.Now()
+	if !ok || session.revoked || !now.Before(session.expiresAt) || !now.Before(session.idleExpiresAt) {
+		return "", false
+	}
+	if now.Sub(session.lastSeen) > sessionRefreshAfter {
+		session.lastSeen = now
+		session.idleExpiresAt = now.Add(sessionIdleTTL)
+		s.sessions[id] = session
+	}
+	return session.email, true
+}
+
+func (s *memoryStore) RevokeSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok {
+		session.revoked = true
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *memoryStore) RevokeSessions(email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.email == email {
+			session.revoked = true
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) IsGlobalAdmin(email string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.globalAdmins[email]
+}
+
+func (s *memoryStore) IsTripAdmin(email string, tripID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.tripAdmins, func(a *memTripAdmin) bool { return a.TripID == tripID && a.Email == email })
+}
+
+func (s *memoryStore) ListTrips() ([]tripSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var trips []tripSummary
+	for _, t := range s.trips {
+		summary := tripSummary{ID: t.ID, Name: t.Name, PreferNotMultiple: t.PreferNotMultiple, NoPreferCost: t.NoPreferCost, Admins: []tripAdmin{}}
+		for _, a := range s.tripAdmins {
+			if a.TripID == t.ID {
+				summary.Admins = append(summary.Admins, tripAdmin{ID: a.ID, Email: a.Email})
+			}
+		}
+		trips = append(trips, summary)
+	}
+	return trips, nil
+}
+
+func (s *memoryStore) trip(tripID int64) *tripRecord {
+	return findByID(s.trips, tripID, func(t *tripRecord) int64 { return t.ID })
+}
+
+func (s *memoryStore) Trip(tripID int64) (tripRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.trip(tripID)
+	if t == nil {
+		return tripRecord{}, errNotFound
+	}
+	return *t, nil
+}
+
+func (s *memoryStore) CreateTrip(name string, layout *tripLayout) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &tripRecord{ID: s.id(), Name: name, tripSettings: tripSettings{
+		PreferNotMultiple: 5, NoPreferCost: 10, RankWeights: []int64{3, 2, 1}, Objective: "sum", FairnessWeight: 5,
+	}}
+	s.trips = append(s.trips, t)
+	if layout == nil {
+		return t.ID, nil
+	}
+	t.tripSettings = layout.Settings
+	for _, g := range layout.RoomGroups {
+		group := &memRoomGroup{ID: s.id(), TripID: t.ID, Size: g.Size, Count: g.Count}
+		s.roomGroups = append(s.roomGroups, group)
+		for _, room := range g.Rooms {
+			s.rooms = append(s.rooms, &memRoom{ID: s.id(), RoomGroupID: group.ID, Name: room.Name, Floor: room.Floor, Building: room.Building, Capacity: room.Capacity})
+		}
+	}
+	for _, email := range layout.Admins {
+		s.tripAdmins = append(s.tripAdmins, &memTripAdmin{ID: s.id(), TripID: t.ID, Email: email})
+	}
+	return t.ID, nil
+}
+
+func (s *memoryStore) TripTemplate(templateID int64) (tripLayout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.templates[templateID]
+	if !ok {
+		return l, errNotFound
+	}
+	return l, nil
+}
+
+func (s *memoryStore) UpdateTrip(tripID int64, u tripUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.trip(tripID)
+	if t == nil {
+		return errNotFound
+	}
+	u.apply(t)
+	return nil
+}
+
+func (s *memoryStore) DeleteTrip(tripID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trip(tripID) == nil {
+		return false, nil
+	}
+	s.trips = slices.DeleteFunc(s.trips, func(t *tripRecord) bool { return t.ID == tripID })
+	s.tripAdmins = slices.DeleteFunc(s.tripAdmins, func(a *memTripAdmin) bool { return a.TripID == tripID })
+	var studentIDs, groupIDs []int64
+	for _, st := range s.students {
+		if st.TripID == tripID {
+			studentIDs = append(studentIDs, st.ID)
+		}
+	}
+	for _, g := range s.roomGroups {
+		if g.TripID == tripID {
+			groupIDs = append(groupIDs, g.ID)
+		}
+	}
+	for _, id := range studentIDs {
+		s.deleteStudent(id)
+	}
+	for _, id := range groupIDs {
+		s.deleteRoomGroup(id)
+	}
+	return true, nil
+}
+
+func (s *memoryStore) AddTripAdmin(tripID int64, email string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trip(tripID) == nil {
+		return 0, fmt.Errorf("trip %d does not exist", tripID)
+	}
+	if slices.ContainsFunc(s.tripAdmins, func(a *memTripAdmin) bool { return a.TripID == tripID && a.Email == email }) {
+		return 0, fmt.Errorf("%s is already an admin of trip %d", email, tripID)
+	}
+	a := &memTripAdmin{ID: s.id(), TripID: tripID, Email: email}
+	s.tripAdmins = append(s.tripAdmins, a)
+	return a.ID, nil
+}
+
+func (s *memoryStore) RemoveTripAdmin(adminID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.tripAdmins)
+	s.tripAdmins = slices.DeleteFunc(s.tripAdmins, func(a *memTripAdmin) bool { return a.ID == adminID })
+	return len(s.tripAdmins) < n, nil
+}
+
+func (s *memoryStore) PreferenceWindow(tripID int64, level string, studentID int64) (preferenceWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.trip(tripID)
+	if t == nil {
+		return preferenceWindow{}, errNotFound
+	}
+	pw := preferenceWindow{OpensAt: t.ParentOpensAt, ClosesAt: t.ParentClosesAt}
+	if level == "student" {
+		pw = preferenceWindow{OpensAt: t.StudentOpensAt, ClosesAt: t.StudentClosesAt}
+	}
+	for _, e := range s.extensions {
+		if e.StudentID == studentID && e.Level == level {
+			pw.extend(&e.ClosesAt)
+		}
+	}
+	return pw, nil
+}
+
+func (s *memoryStore) MaxRoomCapacity(tripID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	capacity := 0
+	for _, room := range s.rooms {
+		if g := s.roomGroup(room.RoomGroupID); g != nil && g.TripID == tripID {
+			capacity = max(capacity, room.Capacity)
+		}
+	}
+	return capacity, nil
+}
+
+func (s *memoryStore) student(studentID int64) *memStudent {
+	return findByID(s.students, studentID, func(st *memStudent) int64 { return st.ID })
+}
+
+func (s *memoryStore) ListStudents(tripID int64) ([]studentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var students []studentRecord
+	for _, st := range s.students {
+		if st.TripID != tripID {
+			continue
+		}
+		record := studentRecord{ID: st.ID, Name: st.Name, Email: st.Email, Parents: []parentRecord{}, Attributes: map[string]string{}}
+		for _, p := range s.parents {
+			if p.StudentID == st.ID {
+				record.Parents = append(record.Parents, parentRecord{ID: p.ID, Email: p.Email})
+			}
+		}
+		for key, value := range s.attributes[st.ID] {
+			record.Attributes[key] = value
+		}
+		students = append(students, record)
+	}
+	slices.SortStableFunc(students, func(a, b studentRecord) int { return cmp.Compare(a.Name, b.Name) })
+	return students, nil
+}
+
+func (s *memoryStore) StudentsByEmail(tripID int64, email string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int64
+	for _, st := range s.students {
+		if st.TripID == tripID && st.Email == email {
+			ids = append(ids, st.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) StudentsByParentEmail(tripID int64, email string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int64
+	for _, p := range s.parents {
+		if st := s.student(p.StudentID); st != nil && st.TripID == tripID && p.Email == email {
+			ids = append(ids, st.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) CreateStudent(tripID int64, name, email string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trip(tripID) == nil {
+		return 0, fmt.Errorf("trip %d does not exist", tripID)
+	}
+	if slices.ContainsFunc(s.students, func(st *memStudent) bool { return st.TripID == tripID && st.Email == email }) {
+		return 0, fmt.Errorf("a student with email %s already exists", email)
+	}
+	st := &memStudent{ID: s.id(), TripID: tripID, Name: name, Email: email}
+	s.students = append(s.students, st)
+	return st.ID, nil
+}
+
+func (s *memoryStore) DeleteStudent(tripID, studentID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st := s.student(studentID); st == nil || st.TripID != tripID {
+		return false, nil
+	}
+	s.deleteStudent(studentID)
+	return true, nil
+}
+
+func (s *memoryStore) deleteStudent(studentID int64) {
+	s.students = slices.DeleteFunc(s.students, func(st *memStudent) bool { return st.ID == studentID })
+	s.parents = slices.DeleteFunc(s.parents, func(p *memParent) bool { return p.StudentID == studentID })
+	s.constraints = slices.DeleteFunc(s.constraints, func(c *memConstraint) bool {
+		return c.StudentAID == studentID || c.StudentBID == studentID
+	})
+	s.extensions = slices.DeleteFunc(s.extensions, func(e *memWindowExtension) bool { return e.StudentID == studentID })
+	delete(s.attributes, studentID)
+}
+
+func (s *memoryStore) AddParent(tripID, studentID int64, email string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st := s.student(studentID); st == nil || st.TripID != tripID {
+		return 0, fmt.Errorf("student %d does not exist", studentID)
+	}
+	if slices.ContainsFunc(s.parents, func(p *memParent) bool { return p.StudentID == studentID && p.Email == email }) {
+		return 0, fmt.Errorf("%s is already a parent of student %d", email, studentID)
+	}
+	p := &memParent{ID: s.id(), StudentID: studentID, Email: email}
+	s.parents = append(s.parents, p)
+	return p.ID, nil
+}
+
+func (s *memoryStore) RemoveParent(tripID, parentID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.parents)
+	s.parents = slices.DeleteFunc(s.parents, func(p *memParent) bool {
+		st := s.student(p.StudentID)
+		return p.ID == parentID && st != nil && st.TripID == tripID
+	})
+	return len(s.parents) < n, nil
+}
+
+func (s *memoryStore) ListConstraints(tripID int64, level string, studentAIDs []int64) ([]constraintRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var constraints []constraintRecord
+	for _, c := range s.constraints {
+		a, b := s.student(c.StudentAID), s.student(c.StudentBID)
+		if a.TripID != tripID {
+			continue
+		}
+		if level != "" && (c.Level != level || !slices.Contains(studentAIDs, c.StudentAID)) {
+			continue
+		}
+		constraints = append(constraints, constraintRecord{
+			ID: c.ID, StudentAID: a.ID, StudentAName: a.Name, StudentBID: b.ID, StudentBName: b.Name,
+			Kind: c.Kind, Level: c.Level, Rank: c.Rank,
+		})
+	}
+	return constraints, nil
+}
+
+func (s *memoryStore) constraint(studentAID, studentBID int64, level string) *memConstraint {
+	i := slices.IndexFunc(s.constraints, func(c *memConstraint) bool {
+		return c.StudentAID == studentAID && c.StudentBID == studentBID && c.Level == level
+	})
+	if i < 0 {
+		return nil
+	}
+	return s.constraints[i]
+}
+
+func (s *memoryStore) FindConstraint(studentAID, studentBID int64, level string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.constraint(studentAID, studentBID, level); c != nil {
+		return c.ID, true
+	}
+	return 0, false
+}
+
+func (s *memoryStore) SetConstraint(tripID int64, c constraintRecord) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, b := s.student(c.StudentAID), s.student(c.StudentBID)
+	if a == nil || b == nil || a.TripID != tripID || b.TripID != tripID {
+		return 0, errNotFound
+	}
+	if existing := s.constraint(c.StudentAID, c.StudentBID, c.Level); existing != nil {
+		existing.Kind, existing.Rank = c.Kind, c.Rank
+		return existing.ID, nil
+	}
+	row := &memConstraint{ID: s.id(), StudentAID: c.StudentAID, StudentBID: c.StudentBID, Kind: c.Kind, Level: c.Level, Rank: c.Rank}
+	s.constraints = append(s.constraints, row)
+	return row.ID, nil
+}
+
+func (s *memoryStore) DeleteConstraint(tripID, constraintID int64, level string, studentAIDs []int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.constraints)
+	s.constraints = slices.DeleteFunc(s.constraints, func(c *memConstraint) bool {
+		if c.ID != constraintID {
+			return false
+		}
+		if level == "" {
+			return s.student(c.StudentAID).TripID == tripID
+		}
+		return c.Level == level && slices.Contains(studentAIDs, c.StudentAID)
+	})
+	return len(s.constraints) < n, nil
+}
+
+func (s *memoryStore) roomGroup(groupID int64) *memRoomGroup {
+	return findByID(s.roomGroups, groupID, func(g *memRoomGroup) int64 { return g.ID })
+}
+
+func (s *memoryStore) ListRoomGroups(tripID int64) ([]roomGroupRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var groups []roomGroupRecord
+	for _, g := range s.roomGroups {
+		if g.TripID == tripID {
+			groups = append(groups, roomGroupRecord{ID: g.ID, Size: g.Size, Count: g.Count})
+		}
+	}
+	return groups, nil
+}
+
+func (s *memoryStore) CreateRoomGroup(tripID int64, g newRoomGroup) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trip(tripID) == nil {
+		return 0, fmt.Errorf("trip %d does not exist", tripID)
+	}
+	group := &memRoomGroup{ID: s.id(), TripID: tripID, Size: g.Size, Count: g.Count}
+	s.roomGroups = append(s.roomGroups, group)
+	for _, name := range g.roomNames() {
+		s.rooms = append(s.rooms, &memRoom{ID: s.id(), RoomGroupID: group.ID, Name: name, Floor: g.Floor, Building: g.Building, Capacity: g.Size})
+	}
+	return group.ID, nil
+}
+
+func (s *memoryStore) DeleteRoomGroup(tripID, groupID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g := s.roomGroup(groupID); g == nil || g.TripID != tripID {
+		return false, nil
+	}
+	s.deleteRoomGroup(groupID)
+	return true, nil
+}
+
+func (s *memoryStore) deleteRoomGroup(groupID int64) {
+	s.roomGroups = slices.DeleteFunc(s.roomGroups, func(g *memRoomGroup) bool { return g.ID == groupID })
+	s.rooms = slices.DeleteFunc(s.rooms, func(r *memRoom) bool { return r.RoomGroupID == groupID })
+}
+
+func (s *memoryStore) RecordAudit(e auditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, e)
+}
+
+// auditActions lists the recorded audit actions in order.
+func (s *memoryStore) auditActions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var actions []string
+	for _, e := range s.audit {
+		actions = append(actions, e.Action)
+	}
+	return actions
+}
+
+func (s *memoryStore) AuditRow(table string, id int64) auditRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var row any
+	switch table {
+	case "trips":
+		row = s.trip(id)
+	case "trip_admins":
+		row = findByID(s.tripAdmins, id, func(a *memTripAdmin) int64 { return a.ID })
+	case "students":
+		row = s.student(id)
+	case "parents":
+		row = findByID(s.parents, id, func(p *memParent) int64 { return p.ID })
+	case "roommate_constraints":
+		row = findByID(s.constraints, id, func(c *memConstraint) int64 { return c.ID })
+	case "room_groups":
+		row = s.roomGroup(id)
+	}
+	raw, err := json.Marshal(row)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var r auditRow
+	if dec.Decode(&r) != nil {
+		return nil
+	}
+	return r
+}
+
+func findByID[T any](rows []*T, id int64, key func(*T) int64) *T {
+	i := slices.IndexFunc(rows, func(row *T) bool { return key(row) == id })
+	if i < 0 {
+		return nil
+	}
+	return rows[i]
+}
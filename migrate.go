@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migrationLockID is the Postgres advisory lock key held while migrating, so
+// that instances booting together apply each migration once.
+const migrationLockID = 0x726f6f6d73
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads migrations/NNNN_name.up.sql and the matching optional
+// .down.sql files, in version order.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		num, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", e.Name())
+		}
+		raw, err := migrationFS.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		} else if m.name != name {
+			return nil, fmt.Errorf("migrations %04d_%s and %04d_%s share a version", version, m.name, version, name)
+		}
+		if direction == "up" {
+			m.up = string(raw)
+		} else {
+			m.down = string(raw)
+		}
+	}
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a single connection holding the advisory lock,
+// after making sure schema_migrations exists.
+func withMigrationLock(db *sql.DB, fn func(ctx context.Context, conn *sql.Conn, applied map[int]time.Time) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = at
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return fn(ctx, conn, applied)
+}
+
+// runMigration executes one migration and records it in the same transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	script, record := m.up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	if !up {
+		script, record = m.down, "DELETE FROM schema_migrations WHERE version = $1 AND name = $2"
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateUp(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(db, func(ctx context.Context, conn *sql.Conn, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+			log.Printf("applied migration %04d_%s", m.version, m.name)
+		}
+		return nil
+	})
+}
+
+// migrateDown reverts the steps most recently applied migrations.
+func migrateDown(db *sql.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(db, func(ctx context.Context, conn *sql.Conn, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %04d_%s cannot be reverted", m.version, m.name)
+			}
+			if err := runMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			log.Printf("reverted migration %04d_%s", m.version, m.name)
+			steps--
+		}
+		return nil
+	})
+}
+
+func migrationStatus(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return withMigrationLock(db, func(ctx context.Context, conn *sql.Conn, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			state := "pending"
+			if at, ok := applied[m.version]; ok {
+				state = "applied " + at.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.version, m.name, state)
+		}
+		return nil
+	})
+}
+
+// runMigrateCommand implements `rooms migrate up|down [steps]|status`.
+func runMigrateCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: rooms migrate up | down [steps] | status")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	if os.Getenv("PGCONN") == "" {
+		log.Fatal("PGCONN environment variable is required")
+	}
+	db, err := sql.Open("postgres", os.Getenv("PGCONN"))
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrateUp(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				usage()
+			}
+		}
+		err = migrateDown(db, steps)
+	case "status":
+		err = migrationStatus(db)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("migrate %s: %v", args[0], err)
+	}
+}
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS trip_templates;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS window_extensions;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS global_admins;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS room_rules;
+DROP TABLE IF EXISTS student_attributes;
+DROP TABLE IF EXISTS pinned_students;
+DROP TABLE IF EXISTS assignment_rooms;
+DROP TABLE IF EXISTS assignments;
+DROP TABLE IF EXISTS roommate_constraints;
+DROP TABLE IF EXISTS parents;
+DROP TABLE IF EXISTS students;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS room_groups;
+DROP TABLE IF EXISTS trip_admins;
+DROP TABLE IF EXISTS trips;
+DROP TYPE IF EXISTS constraint_level;
+DROP TYPE IF EXISTS constraint_kind;
@@ -0,0 +1,202 @@
+DO $$ BEGIN
+    CREATE TYPE constraint_kind AS ENUM ('must', 'prefer', 'prefer_not', 'must_not');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$ BEGIN
+    CREATE TYPE constraint_level AS ENUM ('student', 'parent', 'admin');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE TABLE IF NOT EXISTS trips (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefer_not_multiple INTEGER NOT NULL DEFAULT 5,
+    no_prefer_cost INTEGER NOT NULL DEFAULT 10
+);
+
+CREATE TABLE IF NOT EXISTS room_groups (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    size INTEGER NOT NULL,
+    count INTEGER NOT NULL,
+    CHECK(size >= 1),
+    CHECK(count >= 1)
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id BIGSERIAL PRIMARY KEY,
+    room_group_id BIGINT NOT NULL REFERENCES room_groups(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    floor TEXT NOT NULL DEFAULT '',
+    building TEXT NOT NULL DEFAULT '',
+    capacity INTEGER NOT NULL,
+    CHECK(capacity >= 1)
+);
+
+INSERT INTO rooms (room_group_id, capacity)
+SELECT rg.id, rg.size
+FROM room_groups rg, generate_series(1, rg.count)
+WHERE NOT EXISTS (SELECT 1 FROM rooms r WHERE r.room_group_id = rg.id);
+
+CREATE TABLE IF NOT EXISTS trip_admins (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    UNIQUE(trip_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS students (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    UNIQUE(trip_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS parents (
+    id BIGSERIAL PRIMARY KEY,
+    student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    UNIQUE(student_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS roommate_constraints (
+    id BIGSERIAL PRIMARY KEY,
+    student_a_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    student_b_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    kind constraint_kind NOT NULL,
+    level constraint_level NOT NULL,
+    CHECK(student_a_id != student_b_id),
+    UNIQUE(student_a_id, student_b_id, level)
+);
+
+CREATE TABLE IF NOT EXISTS assignments (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    score INTEGER NOT NULL,
+    published BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(trip_id, name, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS assignments_one_published ON assignments(trip_id) WHERE published;
+
+CREATE TABLE IF NOT EXISTS assignment_rooms (
+    id BIGSERIAL PRIMARY KEY,
+    assignment_id BIGINT NOT NULL REFERENCES assignments(id) ON DELETE CASCADE,
+    room INTEGER NOT NULL,
+    room_id BIGINT REFERENCES rooms(id) ON DELETE SET NULL,
+    student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    UNIQUE(assignment_id, student_id)
+);
+
+CREATE TABLE IF NOT EXISTS pinned_students (
+    id BIGSERIAL PRIMARY KEY,
+    student_id BIGINT NOT NULL UNIQUE REFERENCES students(id) ON DELETE CASCADE,
+    room_id BIGINT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS student_attributes (
+    student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY(student_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS room_rules (
+    id BIGSERIAL PRIMARY KEY,
+    room_group_id BIGINT REFERENCES room_groups(id) ON DELETE CASCADE,
+    room_id BIGINT REFERENCES rooms(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    CHECK((room_group_id IS NULL) != (room_id IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    idle_expires_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_email ON sessions(email);
+
+CREATE TABLE IF NOT EXISTS global_admins (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    granted_by TEXT NOT NULL,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT,
+    actor TEXT NOT NULL,
+    role TEXT NOT NULL,
+    action TEXT NOT NULL,
+    student_ids BIGINT[] NOT NULL DEFAULT '{}',
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_trip ON audit_log(trip_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_log_students ON audit_log USING GIN(student_ids);
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS student_opens_at TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS student_closes_at TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS parent_opens_at TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS parent_closes_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS window_extensions (
+    id BIGSERIAL PRIMARY KEY,
+    student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    level constraint_level NOT NULL,
+    closes_at TIMESTAMPTZ NOT NULL,
+    granted_by TEXT NOT NULL,
+    UNIQUE(student_id, level)
+);
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS rank_weights INTEGER[] NOT NULL DEFAULT '{3,2,1}';
+ALTER TABLE roommate_constraints ADD COLUMN IF NOT EXISTS rank INTEGER CHECK(rank >= 1);
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS objective TEXT NOT NULL DEFAULT 'sum';
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS fairness_weight INTEGER NOT NULL DEFAULT 5;
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS singleton_cost INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS min_occupancy INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS underfill_cost INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS imbalance_cost INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id BIGINT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    dedupe_key TEXT NOT NULL UNIQUE,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS notifications_due ON notifications(next_attempt_at) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS notifications_trip ON notifications(trip_id, id);
+
+CREATE TABLE IF NOT EXISTS trip_templates (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    layout JSONB NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
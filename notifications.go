@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed emails/*.txt
+var emailFS embed.FS
+
+var emailTemplates = texttemplate.Must(texttemplate.ParseFS(emailFS, "emails/*.txt"))
+
+const (
+	notifyInterval  = time.Minute
+	reminderLead    = 48 * time.Hour
+	maxSendAttempts = 8
+	notifyBatch     = 50
+)
+
+type emailData struct {
+	Trip     string
+	Student  string
+	Level    string
+	ClosesAt string
+	URL      string
+}
+
+// renderEmail executes emails/<kind>.txt, whose first line is the subject.
+func renderEmail(kind string, data emailData) (string, string, error) {
+	var buf bytes.Buffer
+	if err := emailTemplates.ExecuteTemplate(&buf, kind+".txt", data); err != nil {
+		return "", "", err
+	}
+	subject, body, _ := strings.Cut(buf.String(), "\n")
+	return strings.TrimPrefix(subject, "Subject: "), strings.TrimLeft(body, "\n"), nil
+}
+
+type recipient struct {
+	studentID int64
+	name      string
+	email     string
+	closesAt  *time.Time // the student's window extension, if any
+}
+
+// tripRecipients lists the students of a trip, or their parents. With pending
+// set it leaves out anyone who already has preferences at that level and
+// reports each student's own window extension at that level.
+func tripRecipients(db *sql.DB, tripID int64, level string, pending bool) ([]recipient, error) {
+	columns, from, closesAt := "s.id, s.name, s.email", "students s", "NULL::timestamptz"
+	if level == "parent" {
+		columns, from = "s.id, s.name, p.email", "parents p JOIN students s ON s.id = p.student_id"
+	}
+	where := "s.trip_id = $1"
+	args := []any{tripID}
+	if pending {
+		from += " LEFT JOIN window_extensions we ON we.student_id = s.id AND we.level = $2::constraint_level"
+		closesAt = "we.closes_at"
+		where += " AND NOT EXISTS (SELECT 1 FROM roommate_constraints rc WHERE rc.student_a_id = s.id AND rc.level = $2::constraint_level)"
+		args = append(args, level)
+	}
+	rows, err := db.Query("SELECT "+columns+", "+closesAt+" FROM "+from+" WHERE "+where+" ORDER BY s.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recipients []recipient
+	for rows.Next() {
+		var rc recipient
+		if err := rows.Scan(&rc.studentID, &rc.name, &rc.email, &rc.closesAt); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, rc)
+	}
+	return recipients, rows.Err()
+}
+
+// queueTripEmails renders kind for every recipient at the given levels and
+// queues it. Each email is keyed by its kind, recipient and occasion, so
+// queueing the same occasion again only reaches people added since. Pending
+// emails are reminders: they only go to recipients whose own deadline, the
+// trip's or their extension's, is due within reminderLead.
+func queueTripEmails(db *sql.DB, tripID int64, kind string, levels []string, occasion string, closesAt *time.Time, pending bool) (int, error) {
+	data := emailData{}
+	if err := db.QueryRow("SELECT name FROM trips WHERE id = $1", tripID).Scan(&data.Trip); err != nil {
+		return 0, err
+	}
+	if base := os.Getenv("BASE_URL"); base != "" {
+		data.URL = strings.TrimSuffix(base, "/") + "/trip/" + strconv.FormatInt(tripID, 10)
+	}
+	queued := 0
+	for _, level := range levels {
+		recipients, err := tripRecipients(db, tripID, level, pending)
+		if err != nil {
+			return queued, err
+		}
+		data.Level = level
+		for _, rc := range recipients {
+			deadline, on := closesAt, occasion
+			if rc.closesAt != nil {
+				deadline, on = rc.closesAt, rc.closesAt.UTC().Format(time.RFC3339)
+			}
+			if pending && (deadline == nil || !reminderDue(*deadline)) {
+				continue
+			}
+			data.ClosesAt = ""
+			if deadline != nil {
+				data.ClosesAt = deadline.Local().Format("Monday, January 2 at 3:04 PM MST")
+			}
+			data.Student = rc.name
+			subject, body, err := renderEmail(kind, data)
+			if err != nil {
+				return queued, err
+			}
+			key := fmt.Sprintf("%s/%d/%s/%d/%s/%s", kind, tripID, level, rc.studentID, rc.email, on)
+			result, err := db.Exec(`
+				INSERT INTO notifications (trip_id, kind, recipient, dedupe_key, subject, body)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (dedupe_key) DO NOTHING`, tripID, kind, rc.email, key, subject, body)
+			if err != nil {
+				return queued, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				queued++
+			}
+		}
+	}
+	return queued, nil
+}
+
+func reminderDue(closesAt time.Time) bool {
+	left := time.Until(closesAt)
+	return left > 0 && left <= reminderLead
+}
+
+// queueReminders queues a reminder for everyone who has not submitted
+// preferences once a window is open and due to close within reminderLead,
+// and for students whose own window extension is due to close.
+func queueReminders(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT id, 'student', student_closes_at FROM trips
+		WHERE student_closes_at > now() AND student_closes_at <= $1 AND (student_opens_at IS NULL OR student_opens_at <= now())
+		UNION
+		SELECT id, 'parent', parent_closes_at FROM trips
+		WHERE parent_closes_at > now() AND parent_closes_at <= $1 AND (parent_opens_at IS NULL OR parent_opens_at <= now())
+		UNION
+		SELECT t.id, we.level::text, CASE we.level WHEN 'student' THEN t.student_closes_at ELSE t.parent_closes_at END
+		FROM window_extensions we
+		JOIN students s ON s.id = we.student_id
+		JOIN trips t ON t.id = s.trip_id
+		WHERE we.closes_at > now() AND we.closes_at <= $1`,
+		time.Now().Add(reminderLead))
+	if err != nil {
+		return err
+	}
+	type due struct {
+		tripID   int64
+		level    string
+		closesAt *time.Time
+	}
+	var windows []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.tripID, &d.level, &d.closesAt); err != nil {
+			rows.Close()
+			return err
+		}
+		windows = append(windows, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, d := range windows {
+		occasion := ""
+		if d.closesAt != nil {
+			occasion = d.closesAt.UTC().Format(time.RFC3339)
+		}
+		if _, err := queueTripEmails(db, d.tripID, "reminder", []string{d.level}, occasion, d.closesAt, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverNotifications claims a batch of due emails and sends them. Claiming
+// bumps the attempt count and pushes the next attempt out with exponential
+// backoff, so a failed send is retried later and a crash mid-send is too.
+func deliverNotifications(db *sql.DB, mailer Mailer) error {
+	rows, err := db.Query(`
+		UPDATE notifications
+		SET attempts = attempts + 1, next_attempt_at = now() + make_interval(mins => LEAST(power(2, attempts)::int, 360))
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE sent_at IS NULL AND attempts < $1 AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, recipient, subject, body`, maxSendAttempts, notifyBatch)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id                       int64
+		recipient, subject, body string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.recipient, &p.subject, &p.body); err != nil {
+			rows.Close()
+			return err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range batch {
+		if err := mailer.Send(p.recipient, p.subject, p.body); err != nil {
+			log.Printf("failed to send notification %d to %s: %v", p.id, p.recipient, err)
+			if _, err := db.Exec("UPDATE notifications SET last_error = $2 WHERE id = $1", p.id, err.Error()); err != nil {
+				log.Printf("failed to record error for notification %d: %v", p.id, err)
+			}
+			continue
+		}
+		if _, err := db.Exec("UPDATE notifications SET sent_at = now(), last_error = NULL WHERE id = $1", p.id); err != nil {
+			log.Printf("failed to mark notification %d sent: %v", p.id, err)
+		}
+	}
+	return nil
+}
+
+func runNotifier(db *sql.DB, mailer Mailer) {
+	for {
+		if err := queueReminders(db); err != nil {
+			log.Println("failed to queue reminders:", err)
+		}
+		if mailer != nil {
+			if err := deliverNotifications(db, mailer); err != nil {
+				log.Println("failed to deliver notifications:", err)
+			}
+		}
+		time.Sleep(notifyInterval)
+	}
+}
+
+func handleListNotifications(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.Query(`
+			SELECT id, kind, recipient, subject, attempts, last_error, sent_at, created_at
+			FROM notifications
+			WHERE trip_id = $1
+			ORDER BY id DESC
+			LIMIT 500`, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		type notification struct {
+			ID        int64      `json:"id"`
+			Kind      string     `json:"kind"`
+			Recipient string     `json:"recipient"`
+			Subject   string     `json:"subject"`
+			Attempts  int        `json:"attempts"`
+			LastError *string    `json:"last_error"`
+			SentAt    *time.Time `json:"sent_at"`
+			CreatedAt time.Time  `json:"created_at"`
+		}
+		notifications := []notification{}
+		for rows.Next() {
+			var n notification
+			if err := rows.Scan(&n.ID, &n.Kind, &n.Recipient, &n.Subject, &n.Attempts, &n.LastError, &n.SentAt, &n.CreatedAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			notifications = append(notifications, n)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notifications)
+	}
+}
+
+func handleSendInvites(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Level != "student" && body.Level != "parent") {
+			http.Error(w, "level must be student or parent", http.StatusBadRequest)
+			return
+		}
+		pw, err := loadPreferenceWindow(db, tripID, body.Level, 0)
+		if err != nil {
+			http.Error(w, "trip not found", http.StatusNotFound)
+			return
+		}
+		occasion := ""
+		if pw.OpensAt != nil {
+			occasion = pw.OpensAt.UTC().Format(time.RFC3339)
+		}
+		queued, err := queueTripEmails(db, tripID, "invite", []string{body.Level}, occasion, pw.ClosesAt, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "notification.invite", After: map[string]any{"level": body.Level, "queued": queued}})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"queued": queued})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	pdfPageWidth  = 612
+	pdfPageHeight = 792
+	pdfMargin     = 50
+)
+
+type pdfLine struct {
+	text   string
+	size   float64
+	bold   bool
+	indent float64
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '—' || r == '–':
+			b.WriteByte('-')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfEncodable reports whether pdfEscape can show every rune of s; the
+// built-in fonts only cover Latin-1.
+func pdfEncodable(s string) bool {
+	for _, r := range s {
+		switch {
+		case r == '—' || r == '–':
+		case r >= 0x20 && r < 0x7f:
+		case r >= 0xa0 && r <= 0xff:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func pdfWrap(line pdfLine) []pdfLine {
+	maxChars := int((pdfPageWidth - 2*pdfMargin - line.indent) / (line.size * 0.5))
+	words := strings.Fields(line.text)
+	var out []pdfLine
+	cur := ""
+	for _, w := range words {
+		if cur != "" && len(cur)+1+len(w) > maxChars {
+			out = append(out, pdfLine{cur, line.size, line.bold, line.indent})
+			cur = ""
+		}
+		if cur != "" {
+			cur += " "
+		}
+		cur += w
+	}
+	return append(out, pdfLine{cur, line.size, line.bold, line.indent})
+}
+
+func renderPDF(lines []pdfLine) []byte {
+	var pages []string
+	var content strings.Builder
+	y := float64(pdfPageHeight - pdfMargin)
+	for _, l := range lines {
+		for _, wl := range pdfWrap(l) {
+			if y-wl.size*1.4 < pdfMargin {
+				pages = append(pages, content.String())
+				content.Reset()
+				y = pdfPageHeight - pdfMargin
+			}
+			y -= wl.size * 1.4
+			font := "F1"
+			if wl.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, wl.size, pdfMargin+wl.indent, y, pdfEscape(wl.text))
+		}
+	}
+	pages = append(pages, content.String())
+
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(page), page))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresStore is the production Store. Handlers that have not moved to the
+// Store interface still take the *sql.DB and wrap it as postgresStore{db}
+// when they call the shared authorization helpers.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func (s postgresStore) CreateSession(id, email string, issuedAt, expiresAt, idleExpiresAt time.Time) error {
+	if _, err := s.db.Exec(`
+		INSERT INTO sessions (id, email, issued_at, expires_at, idle_expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		id, email, issuedAt, expiresAt, idleExpiresAt); err != nil {
+		return err
+	}
+	s.db.Exec("DELETE FROM sessions WHERE expires_at < now() OR idle_expires_at < now()")
+	return nil
+}
+
+func (s postgresStore) ActiveSession(id string) (string, bool) {
+	var email string
+	var lastSeen time.Time
+	err := s.db.QueryRow(`
+		SELECT email, last_seen_at FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > now() AND idle_expires_at > now()`,
+		id).Scan(&email, &lastSeen)
+	if err != nil {
+		return "", false
+	}
+	if time.Since(lastSeen) > sessionRefreshAfter {
+		s.db.Exec("UPDATE sessions SET last_seen_at = now(), idle_expires_at = now() + $2 * interval '1 second' WHERE id = $1",
+			id, int64(sessionIdleTTL/time.Second))
+	}
+	return email, true
+}
+
+func (s postgresStore) RevokeSession(id string) error {
+	_, err := s.db.Exec("UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	return err
+}
+
+func (s postgresStore) RevokeSessions(email string) error {
+	_, err := s.db.Exec("UPDATE sessions SET revoked_at = now() WHERE email = $1 AND revoked_at IS NULL", email)
+	return err
+}
+
+func (s postgresStore) IsGlobalAdmin(email string) bool {
+	var exists bool
+	s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM global_admins WHERE email = $1)", email).Scan(&exists)
+	return exists
+}
+
+func (s postgresStore) IsTripAdmin(email string, tripID int64) bool {
+	var exists bool
+	s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM trip_admins WHERE trip_id = $1 AND email = $2)", tripID, email).Scan(&exists)
+	return exists
+}
+
+func (s postgresStore) ListTrips() ([]tripSummary, error) {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.name, t.prefer_not_multiple, t.no_prefer_cost, COALESCE(
+			json_agg(json_build_object('id', ta.id, 'email', ta.email)) FILTER (WHERE ta.id IS NOT NULL),
+			'[]'
+		)
+		FROM trips t
+		LEFT JOIN trip_admins ta ON ta.trip_id = t.id
+		GROUP BY t.id, t.name, t.prefer_not_multiple, t.no_prefer_cost
+		ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var trips []tripSummary
+	for rows.Next() {
+		var t tripSummary
+		var adminsJSON string
+		if err := rows.Scan(&t.ID, &t.Name, &t.PreferNotMultiple, &t.NoPreferCost, &adminsJSON); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(adminsJSON), &t.Admins)
+		trips = append(trips, t)
+	}
+	return trips, rows.Err()
+}
+
+func (s postgresStore) Trip(tripID int64) (tripRecord, error) {
+	t := tripRecord{ID: tripID}
+	err := s.db.QueryRow(`
+		SELECT name, prefer_not_multiple, no_prefer_cost, rank_weights, objective, fairness_weight,
+			singleton_cost, min_occupancy, underfill_cost, imbalance_cost,
+			student_opens_at, student_closes_at, parent_opens_at, parent_closes_at
+		FROM trips WHERE id = $1`, tripID).Scan(&t.Name, &t.PreferNotMultiple, &t.NoPreferCost, pq.Array(&t.RankWeights), &t.Objective, &t.FairnessWeight,
+		&t.SingletonCost, &t.MinOccupancy, &t.UnderfillCost, &t.ImbalanceCost,
+		&t.StudentOpensAt, &t.StudentClosesAt, &t.ParentOpensAt, &t.ParentClosesAt)
+	return t, err
+}
+
+func (s postgresStore) CreateTrip(name string, layout *tripLayout) (int64, error) {
+	var id int64
+	if layout == nil {
+		err := s.db.QueryRow("INSERT INTO trips (name) VALUES ($1) RETURNING id", name).Scan(&id)
+		return id, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if id, err = layout.createTrip(tx, name); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (s postgresStore) TripTemplate(templateID int64) (tripLayout, error) {
+	return loadTripTemplate(s.db, templateID)
+}
+
+func (s postgresStore) UpdateTrip(tripID int64, u tripUpdate) error {
+	values := map[string]any{}
+	for column, v := range map[string]*int{
+		"prefer_not_multiple": u.PreferNotMultiple,
+		"no_prefer_cost":      u.NoPreferCost,
+		"fairness_weight":     u.FairnessWeight,
+		"singleton_cost":      u.SingletonCost,
+		"min_occupancy":       u.MinOccupancy,
+		"underfill_cost":      u.UnderfillCost,
+		"imbalance_cost":      u.ImbalanceCost,
+	} {
+		if v != nil {
+			values[column] = *v
+		}
+	}
+	if u.Objective != nil {
+		values["objective"] = *u.Objective
+	}
+	if u.RankWeights != nil {
+		values["rank_weights"] = pq.Array(u.RankWeights)
+	}
+	for column, t := range u.Windows {
+		values[column] = t
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for column, value := range values {
+		if _, err := tx.Exec("UPDATE trips SET "+column+" = $1 WHERE id = $2", value, tripID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s postgresStore) DeleteTrip(tripID int64) (bool, error) {
+	return s.deleted("DELETE FROM trips WHERE id = $1", tripID)
+}
+
+func (s postgresStore) AddTripAdmin(tripID int64, email string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO trip_admins (trip_id, email) VALUES ($1, $2) RETURNING id", tripID, email).Scan(&id)
+	return id, err
+}
+
+func (s postgresStore) RemoveTripAdmin(adminID int64) (bool, error) {
+	return s.deleted("DELETE FROM trip_admins WHERE id = $1", adminID)
+}
+
+func (s postgresStore) PreferenceWindow(tripID int64, level string, studentID int64) (preferenceWindow, error) {
+	return loadPreferenceWindow(s.db, tripID, level, studentID)
+}
+
+func (s postgresStore) MaxRoomCapacity(tripID int64) (int, error) {
+	var capacity int
+	err := s.db.QueryRow("SELECT COALESCE(MAX(r.capacity), 0) FROM rooms r JOIN room_groups rg ON rg.id = r.room_group_id WHERE rg.trip_id = $1", tripID).Scan(&capacity)
+	return capacity, err
+}
+
+func (s postgresStore) ListStudents(tripID int64) ([]studentRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.name, s.email, COALESCE(
+			json_agg(json_build_object('id', p.id, 'email', p.email)) FILTER (WHERE p.id IS NOT NULL),
+			'[]'
+		), COALESCE(
+			(SELECT json_object_agg(sa.key, sa.value) FROM student_attributes sa WHERE sa.student_id = s.id),
+			'{}'
+		)
+		FROM students s
+		LEFT JOIN parents p ON p.student_id = s.id
+		WHERE s.trip_id = $1
+		GROUP BY s.id, s.name, s.email
+		ORDER BY s.name`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var students []studentRecord
+	for rows.Next() {
+		var st studentRecord
+		var parentsJSON, attributesJSON string
+		if err := rows.Scan(&st.ID, &st.Name, &st.Email, &parentsJSON, &attributesJSON); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(parentsJSON), &st.Parents)
+		json.Unmarshal([]byte(attributesJSON), &st.Attributes)
+		students = append(students, st)
+	}
+	return students, rows.Err()
+}
+
+func (s postgresStore) StudentsByEmail(tripID int64, email string) ([]int64, error) {
+	return s.ids("SELECT id FROM students WHERE trip_id = $1 AND email = $2", tripID, email)
+}
+
+func (s postgresStore) StudentsByParentEmail(tripID int64, email string) ([]int64, error) {
+	return s.ids("SELECT s.id FROM parents p JOIN students s ON s.id = p.student_id WHERE s.trip_id = $1 AND p.email = $2", tripID, email)
+}
+
+func (s postgresStore) CreateStudent(tripID int64, name, email string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO students (trip_id, name, email) VALUES ($1, $2, $3) RETURNING id", tripID, name, email).Scan(&id)
+	return id, err
+}
+
+func (s postgresStore) DeleteStudent(tripID, studentID int64) (bool, error) {
+	return s.deleted("DELETE FROM students WHERE id = $1 AND trip_id = $2", studentID, tripID)
+}
+
+func (s postgresStore) AddParent(tripID, studentID int64, email string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow("INSERT INTO parents (student_id, email) VALUES ((SELECT id FROM students WHERE id = $1 AND trip_id = $2), $3) RETURNING id",
+		studentID, tripID, email).Scan(&id)
+	return id, err
+}
+
+func (s postgresStore) RemoveParent(tripID, parentID int64) (bool, error) {
+	return s.deleted(`DELETE FROM parents WHERE id = $1 AND student_id IN (SELECT id FROM students WHERE trip_id = $2)`, parentID, tripID)
+}
+
+func (s postgresStore) ListConstraints(tripID int64, level string, studentAIDs []int64) ([]constraintRecord, error) {
+	query := `SELECT rc.id, rc.student_a_id, sa.name, rc.student_b_id, sb.name, rc.kind::text, rc.level::text, rc.rank
+		FROM roommate_constraints rc
+		JOIN students sa ON sa.id = rc.student_a_id
+		JOIN students sb ON sb.id = rc.student_b_id
+		WHERE sa.trip_id = $1`
+	args := []any{tripID}
+	if level != "" {
+		query += ` AND rc.level = $2::constraint_level AND rc.student_a_id = ANY($3)`
+		args = append(args, level, pq.Array(studentAIDs))
+	}
+	rows, err := s.db.Query(query+" ORDER BY rc.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var constraints []constraintRecord
+	for rows.Next() {
+		var c constraintRecord
+		if err := rows.Scan(&c.ID, &c.StudentAID, &c.StudentAName, &c.StudentBID, &c.StudentBName, &c.Kind, &c.Level, &c.Rank); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, rows.Err()
+}
+
+func (s postgresStore) FindConstraint(studentAID, studentBID int64, level string) (int64, bool) {
+	var id int64
+	err := s.db.QueryRow("SELECT id FROM roommate_constraints WHERE student_a_id = $1 AND student_b_id = $2 AND level = $3::constraint_level",
+		studentAID, studentBID, level).Scan(&id)
+	return id, err == nil
+}
+
+func (s postgresStore) SetConstraint(tripID int64, c constraintRecord) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`
+		INSERT INTO roommate_constraints (student_a_id, student_b_id, kind, level, rank)
+		SELECT $1, $2, $3::constraint_kind, $4::constraint_level, $6
+		FROM students sa
+		JOIN students sb ON sb.id = $2 AND sb.trip_id = $5
+		WHERE sa.id = $1 AND sa.trip_id = $5
+		ON CONFLICT (student_a_id, student_b_id, level) DO UPDATE SET kind = EXCLUDED.kind, rank = EXCLUDED.rank
+		RETURNING id`, c.StudentAID, c.StudentBID, c.Kind, c.Level, tripID, c.Rank).Scan(&id)
+	return id, err
+}
+
+func (s postgresStore) DeleteConstraint(tripID, constraintID int64, level string, studentAIDs []int64) (bool, error) {
+	if level == "" {
+		return s.deleted(`DELETE FROM roommate_constraints WHERE id = $1
+			AND student_a_id IN (SELECT id FROM students WHERE trip_id = $2)`, constraintID, tripID)
+	}
+	return s.deleted(`DELETE FROM roommate_constraints WHERE id = $1
+		AND student_a_id = ANY($2) AND level = $3::constraint_level`, constraintID, pq.Array(studentAIDs), level)
+}
+
+func (s postgresStore) ListRoomGroups(tripID int64) ([]roomGroupRecord, error) {
+	rows, err := s.db.Query("SELECT id, size, count FROM room_groups WHERE trip_id = $1 ORDER BY id", tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups []roomGroupRecord
+	for rows.Next() {
+		var g roomGroupRecord
+		if err := rows.Scan(&g.ID, &g.Size, &g.Count); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (s postgresStore) CreateRoomGroup(tripID int64, g newRoomGroup) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRow("INSERT INTO room_groups (trip_id, size, count) VALUES ($1, $2, $3) RETURNING id", tripID, g.Size, g.Count).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range g.roomNames() {
+		if _, err := tx.Exec("INSERT INTO rooms (room_group_id, name, floor, building, capacity) VALUES ($1, $2, $3, $4, $5)",
+			id, name, g.Floor, g.Building, g.Size); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (s postgresStore) DeleteRoomGroup(tripID, groupID int64) (bool, error) {
+	return s.deleted("DELETE FROM room_groups WHERE id = $1 AND trip_id = $2", groupID, tripID)
+}
+
+func (s postgresStore) RecordAudit(e auditEntry) {
+	recordAudit(s.db, e)
+}
+
+func (s postgresStore) AuditRow(table string, id int64) auditRow {
+	return loadAuditRow(s.db, table, "id", id)
+}
+
+func (s postgresStore) deleted(query string, args ...any) (bool, error) {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+func (s postgresStore) ids(query string, args ...any) ([]int64, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+func handleListPins(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.Query(`
+			SELECT ps.student_id, s.name, ps.room_id
+			FROM pinned_students ps
+			JOIN students s ON s.id = ps.student_id
+			WHERE s.trip_id = $1
+			ORDER BY ps.room_id, s.name`, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		type pin struct {
+			StudentID   int64  `json:"student_id"`
+			StudentName string `json:"student_name"`
+			RoomID      int64  `json:"room_id"`
+		}
+		var pins []pin
+		for rows.Next() {
+			var p pin
+			if err := rows.Scan(&p.StudentID, &p.StudentName, &p.RoomID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			pins = append(pins, p)
+		}
+		if pins == nil {
+			pins = []pin{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pins)
+	}
+}
+
+func handlePinStudents(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			RoomID     int64   `json:"room_id"`
+			StudentIDs []int64 `json:"student_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RoomID == 0 || len(body.StudentIDs) == 0 {
+			http.Error(w, "room_id and student_ids are required", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM rooms r JOIN room_groups rg ON rg.id = r.room_group_id WHERE r.id = $1 AND rg.trip_id = $2)", body.RoomID, tripID).Scan(&exists)
+		if !exists {
+			http.Error(w, "room not found", http.StatusBadRequest)
+			return
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		for _, sid := range body.StudentIDs {
+			result, err := tx.Exec(`
+				INSERT INTO pinned_students (student_id, room_id)
+				SELECT id, $2 FROM students WHERE id = $1 AND trip_id = $3
+				ON CONFLICT (student_id) DO UPDATE SET room_id = EXCLUDED.room_id`, sid, body.RoomID, tripID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				http.Error(w, "student "+strconv.FormatInt(sid, 10)+" not found", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "pin.set", StudentIDs: body.StudentIDs, After: body})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleUnpinStudent(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		studentID, err := strconv.ParseInt(r.PathValue("studentID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid student ID", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "pinned_students", "student_id", studentID)
+		result, err := db.Exec(`DELETE FROM pinned_students WHERE student_id = $1 AND student_id IN (SELECT id FROM students WHERE trip_id = $2)`, studentID, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "pin not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "pin.remove", StudentIDs: []int64{studentID}, Before: before})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+const maxRanks = 10
+
+func rankWeight(weights []int64, rank *int) int {
+	if rank == nil || *rank < 1 || *rank > len(weights) {
+		return 1
+	}
+	return int(weights[*rank-1])
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type roomInfo struct {
+	ID          int64  `json:"id"`
+	Number      int    `json:"room"`
+	RoomGroupID int64  `json:"room_group_id"`
+	Name        string `json:"name"`
+	Floor       string `json:"floor"`
+	Building    string `json:"building"`
+	Capacity    int    `json:"capacity"`
+}
+
+func loadTripRooms(db *sql.DB, tripID int64) ([]roomInfo, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.room_group_id, r.name, r.floor, r.building, r.capacity
+		FROM rooms r
+		JOIN room_groups rg ON rg.id = r.room_group_id
+		WHERE rg.trip_id = $1
+		ORDER BY rg.id, r.id`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := []roomInfo{}
+	for rows.Next() {
+		ri := roomInfo{Number: len(rooms) + 1}
+		if err := rows.Scan(&ri.ID, &ri.RoomGroupID, &ri.Name, &ri.Floor, &ri.Building, &ri.Capacity); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, ri)
+	}
+	return rooms, rows.Err()
+}
+
+func handleListRooms(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rooms, err := loadTripRooms(db, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rooms)
+	}
+}
+
+func handleUpdateRoom(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		roomID, err := strconv.ParseInt(r.PathValue("roomID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid room ID", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Name     *string `json:"name"`
+			Floor    *string `json:"floor"`
+			Building *string `json:"building"`
+			Capacity *int    `json:"capacity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if body.Capacity != nil && *body.Capacity < 1 {
+			http.Error(w, "capacity must be at least 1", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "rooms", "id", roomID)
+		result, err := db.Exec(`
+			UPDATE rooms SET
+				name = COALESCE($1, name),
+				floor = COALESCE($2, floor),
+				building = COALESCE($3, building),
+				capacity = COALESCE($4, capacity)
+			WHERE id = $5 AND room_group_id IN (SELECT id FROM room_groups WHERE trip_id = $6)`,
+			body.Name, body.Floor, body.Building, body.Capacity, roomID, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "room.update", Before: before, After: loadAuditRow(db, "rooms", "id", roomID)})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
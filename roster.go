@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 5000
+)
+
+type importRow struct {
+	Line    int      `json:"line"`
+	Name    string   `json:"name"`
+	Email   string   `json:"email"`
+	Parents []string `json:"parents"`
+	Errors  []string `json:"errors"`
+}
+
+func parseRoster(rows [][]string) ([]importRow, []string) {
+	if len(rows) == 0 {
+		return nil, []string{"file is empty"}
+	}
+	nameCol, emailCol := -1, -1
+	var parentCols []int
+	for i, h := range rows[0] {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		switch {
+		case (strings.Contains(h, "parent") || strings.Contains(h, "guardian")) && !strings.Contains(h, "name"):
+			parentCols = append(parentCols, i)
+		case h == "name" || h == "student name" || h == "student":
+			nameCol = i
+		case h == "email" || h == "student email" || h == "e-mail":
+			emailCol = i
+		}
+	}
+	var problems []string
+	if nameCol < 0 {
+		problems = append(problems, "missing name column")
+	}
+	if emailCol < 0 {
+		problems = append(problems, "missing email column")
+	}
+	if problems != nil {
+		return nil, problems
+	}
+	if len(rows) > maxImportRows+1 {
+		return nil, []string{"too many rows"}
+	}
+
+	cell := func(row []string, col int) string {
+		if col < len(row) {
+			return strings.TrimSpace(row[col])
+		}
+		return ""
+	}
+	var out []importRow
+	for i, row := range rows[1:] {
+		ir := importRow{Line: i + 2, Name: cell(row, nameCol), Email: strings.ToLower(cell(row, emailCol)), Parents: []string{}}
+		for _, col := range parentCols {
+			for _, email := range strings.FieldsFunc(cell(row, col), func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+				ir.Parents = append(ir.Parents, strings.ToLower(email))
+			}
+		}
+		if ir.Name == "" && ir.Email == "" && len(ir.Parents) == 0 {
+			continue
+		}
+		out = append(out, ir)
+	}
+	return out, nil
+}
+
+func validateRoster(db *sql.DB, tripID int64, rows []importRow) error {
+	existing := map[string]bool{}
+	dbRows, err := db.Query("SELECT lower(email) FROM students WHERE trip_id = $1", tripID)
+	if err != nil {
+		return err
+	}
+	defer dbRows.Close()
+	for dbRows.Next() {
+		var email string
+		if err := dbRows.Scan(&email); err != nil {
+			return err
+		}
+		existing[email] = true
+	}
+	if err := dbRows.Err(); err != nil {
+		return err
+	}
+	checkRoster(rows, existing)
+	return nil
+}
+
+// checkRoster fills in each row's Errors. existing holds the lower-cased
+// emails of students already on the trip.
+func checkRoster(rows []importRow, existing map[string]bool) {
+	firstLine := map[string]int{}
+	for i := range rows {
+		ir := &rows[i]
+		ir.Errors = []string{}
+		if ir.Name == "" {
+			ir.Errors = append(ir.Errors, "name is required")
+		}
+		switch {
+		case ir.Email == "":
+			ir.Errors = append(ir.Errors, "email is required")
+		case !strings.Contains(ir.Email, "@"):
+			ir.Errors = append(ir.Errors, "invalid email "+ir.Email)
+		case existing[ir.Email]:
+			ir.Errors = append(ir.Errors, "a student with email "+ir.Email+" is already on this trip")
+		case firstLine[ir.Email] != 0:
+			ir.Errors = append(ir.Errors, "duplicate email "+ir.Email+" (also on line "+strconv.Itoa(firstLine[ir.Email])+")")
+		default:
+			firstLine[ir.Email] = ir.Line
+		}
+		seen := map[string]bool{}
+		for _, p := range ir.Parents {
+			switch {
+			case !strings.Contains(p, "@"):
+				ir.Errors = append(ir.Errors, "invalid parent email "+p)
+			case seen[p]:
+				ir.Errors = append(ir.Errors, "duplicate parent email "+p)
+			}
+			seen[p] = true
+		}
+	}
+}
+
+func handleImportStudents(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Format string `json:"format"`
+			Data   string `json:"data"`
+			Commit bool   `json:"commit"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes*2)).Decode(&body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var rows [][]string
+		switch body.Format {
+		case "csv", "":
+			cr := csv.NewReader(strings.NewReader(body.Data))
+			cr.FieldsPerRecord = -1
+			var err error
+			rows, err = cr.ReadAll()
+			if err != nil {
+				http.Error(w, "invalid csv: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		case "xlsx":
+			data, err := base64.StdEncoding.DecodeString(body.Data)
+			if err != nil {
+				http.Error(w, "xlsx data must be base64 encoded", http.StatusBadRequest)
+				return
+			}
+			rows, err = readXLSXRows(data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+			return
+		}
+
+		students, problems := parseRoster(rows)
+		if problems != nil {
+			http.Error(w, strings.Join(problems, "; "), http.StatusBadRequest)
+			return
+		}
+		if err := validateRoster(db, tripID, students); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		valid := len(students) > 0
+		for _, s := range students {
+			if len(s.Errors) > 0 {
+				valid = false
+			}
+		}
+		if students == nil {
+			students = []importRow{}
+		}
+
+		committed := false
+		var createdIDs []int64
+		if body.Commit && valid {
+			tx, err := db.Begin()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer tx.Rollback()
+			for _, s := range students {
+				var id int64
+				if err := tx.QueryRow("INSERT INTO students (trip_id, name, email) VALUES ($1, $2, $3) RETURNING id", tripID, s.Name, s.Email).Scan(&id); err != nil {
+					http.Error(w, "line "+strconv.Itoa(s.Line)+": "+err.Error(), http.StatusConflict)
+					return
+				}
+				createdIDs = append(createdIDs, id)
+				for _, p := range s.Parents {
+					if _, err := tx.Exec("INSERT INTO parents (student_id, email) VALUES ($1, $2)", id, p); err != nil {
+						http.Error(w, "line "+strconv.Itoa(s.Line)+": "+err.Error(), http.StatusConflict)
+						return
+					}
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			committed = true
+			recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "student.import", StudentIDs: createdIDs, After: students})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"rows": students, "valid": valid, "committed": committed})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoster(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     [][]string
+		want     []importRow
+		problems []string
+	}{
+		{
+			name:     "empty file",
+			problems: []string{"file is empty"},
+		},
+		{
+			name:     "missing columns",
+			rows:     [][]string{{"Student", "Grade"}},
+			problems: []string{"missing email column"},
+		},
+		{
+			name:     "no recognised headers",
+			rows:     [][]string{{"First", "Last"}},
+			problems: []string{"missing name column", "missing email column"},
+		},
+		{
+			name: "header variants",
+			rows: [][]string{
+				{"\ufeffStudent Name", " E-mail ", "Parent Name", "Parent Email", "Guardian 2"},
+				{" Ada ", "ADA@Example.com", "Grace", "mum@example.com; dad@example.com", "Gran@Example.com"},
+			},
+			want: []importRow{
+				{Line: 2, Name: "Ada", Email: "ada@example.com", Parents: []string{"mum@example.com", "dad@example.com", "gran@example.com"}},
+			},
+		},
+		{
+			name: "blank and short rows",
+			rows: [][]string{
+				{"Name", "Email", "Parents"},
+				{"", "", ""},
+				{"Ben"},
+				{},
+				{"Cy", "cy@example.com", "a@example.com,b@example.com"},
+			},
+			want: []importRow{
+				{Line: 3, Name: "Ben", Email: "", Parents: []string{}},
+				{Line: 5, Name: "Cy", Email: "cy@example.com", Parents: []string{"a@example.com", "b@example.com"}},
+			},
+		},
+		{
+			name:     "too many rows",
+			rows:     append([][]string{{"name", "email"}}, make([][]string, maxImportRows+1)...),
+			problems: []string{"too many rows"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems := parseRoster(tt.rows)
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Fatalf("problems = %q, want %q", problems, tt.problems)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRoster(t *testing.T) {
+	tests := []struct {
+		name string
+		row  importRow
+		want []string
+	}{
+		{"valid", importRow{Line: 2, Name: "Ada", Email: "ada@example.com", Parents: []string{"mum@example.com"}}, []string{}},
+		{"missing name", importRow{Line: 3, Email: "ben@example.com"}, []string{"name is required"}},
+		{"missing email", importRow{Line: 4, Name: "Cy"}, []string{"email is required"}},
+		{"invalid email", importRow{Line: 5, Name: "Di", Email: "di"}, []string{"invalid email di"}},
+		{"already on trip", importRow{Line: 6, Name: "Ed", Email: "ed@example.com"}, []string{"a student with email ed@example.com is already on this trip"}},
+		{"duplicate email", importRow{Line: 7, Name: "Ada Two", Email: "ada@example.com"}, []string{"duplicate email ada@example.com (also on line 2)"}},
+		{"bad parents", importRow{Line: 8, Name: "Flo", Email: "flo@example.com", Parents: []string{"p@example.com", "nobody", "p@example.com"}},
+			[]string{"invalid parent email nobody", "duplicate parent email p@example.com"}},
+	}
+	rows := make([]importRow, len(tests))
+	for i, tt := range tests {
+		rows[i] = tt.row
+	}
+	checkRoster(rows, map[string]bool{"ed@example.com": true})
+	for i, tt := range tests {
+		if !reflect.DeepEqual(rows[i].Errors, tt.want) {
+			t.Errorf("%s: errors = %q, want %q", tt.name, rows[i].Errors, tt.want)
+		}
+	}
+}
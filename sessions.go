@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sessionIdleTTL      = 14 * 24 * time.Hour
+	sessionMaxTTL       = 60 * 24 * time.Hour
+	sessionRefreshAfter = 5 * time.Minute
+)
+
+type sessionClaims struct {
+	SessionID string `json:"sid"`
+	Email     string `json:"email"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func signToken(payload string) string {
+	h := hmac.New(sha256.New, []byte(os.Getenv("CLIENT_SECRET")))
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func createSession(store Store, email string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := sessionClaims{
+		SessionID: hex.EncodeToString(raw),
+		Email:     email,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(sessionMaxTTL).Unix(),
+	}
+	if err := store.CreateSession(claims.SessionID, email, now, time.Unix(claims.ExpiresAt, 0), now.Add(sessionIdleTTL)); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signToken(encoded), nil
+}
+
+func parseToken(r *http.Request) (sessionClaims, bool) {
+	var claims sessionClaims
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signToken(encoded))) {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, false
+	}
+	if claims.SessionID == "" || time.Now().Unix() >= claims.ExpiresAt {
+		return claims, false
+	}
+	return claims, true
+}
+
+func authorize(store Store, r *http.Request) (string, bool) {
+	claims, ok := parseToken(r)
+	if !ok {
+		return "", false
+	}
+	email, ok := store.ActiveSession(claims.SessionID)
+	if !ok || email != claims.Email {
+		return "", false
+	}
+	return email, true
+}
+
+func handleLogout(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := parseToken(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := store.RevokeSession(claims.SessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleLogoutAll(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := authorize(store, r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := store.RevokeSessions(email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleRevokeUserSessions(store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(store, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+			http.Error(w, "email is required", http.StatusBadRequest)
+			return
+		}
+		if err := store.RevokeSessions(body.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		store.RecordAudit(auditEntry{Actor: email, Role: "global_admin", Action: "sessions.revoke", After: body})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,137 @@
+package solver
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Anneal is simulated annealing over random relocations and swaps of
+// must-together groups. Each restart cools geometrically from StartTemp to
+// EndTemp; the best assignment it passes through is polished with a hill
+// climb before it is compared with the other restarts. When ctx has a
+// deadline, every restart gets an equal share of the time left and cools by
+// whichever of its steps or its time runs out first.
+type Anneal struct {
+	Restarts  int
+	Steps     int
+	StartTemp float64
+	EndTemp   float64
+	Rand      *rand.Rand
+}
+
+var DefaultAnneal = Anneal{
+	Restarts:  4,
+	Steps:     1000000,
+	StartTemp: 3,
+	EndTemp:   0.3,
+}
+
+func (a Anneal) Solve(ctx context.Context, p Problem, progress func(Progress)) (Result, error) {
+	st, assignment, tracker, err := startLocalSearch(p)
+	if err != nil {
+		return Result{}, err
+	}
+	best := slices.Clone(assignment)
+	groups := st.uniqueGroups
+	total := a.Restarts * a.Steps
+	start := time.Now()
+	deadline, timed := ctx.Deadline()
+	var stats Stats
+
+	for restart := range a.Restarts {
+		if ctx.Err() != nil {
+			break
+		}
+		if restart > 0 {
+			st.restart(assignment, tracker, a.Rand)
+		}
+		m := st.newMoveState(assignment)
+		value, bestValue := 0, 0
+		bestIteration, bestAt := stats.Iterations, time.Now()
+		copy(best, assignment)
+		restartStart := time.Now()
+		restartBudget := deadline.Sub(restartStart) / time.Duration(a.Restarts-restart)
+		elapsed := 0.0
+		for step := range a.Steps {
+			if step%1024 == 0 {
+				if ctx.Err() != nil {
+					break
+				}
+				if timed {
+					elapsed = float64(time.Since(restartStart)) / float64(restartBudget)
+					if elapsed >= 1 {
+						break
+					}
+				}
+				if progress != nil && step%4096 == 0 {
+					progress(Progress{Iterations: stats.Iterations, Total: total, BestScore: tracker.bestScore})
+				}
+			}
+			stats.Iterations++
+			temp := a.StartTemp * math.Pow(a.EndTemp/a.StartTemp, max(float64(step)/float64(a.Steps), elapsed))
+			g1 := groups[a.Rand.Intn(len(groups))]
+			var mv move
+			var gain moveGain
+			var ok bool
+			if a.Rand.Intn(2) == 0 {
+				mv = move{group: g1, room: a.Rand.Intn(st.numRooms), swap: -1}
+				gain, ok = m.relocation(g1, mv.room)
+			} else {
+				mv = move{group: g1, room: -1, swap: groups[a.Rand.Intn(len(groups))]}
+				gain, ok = m.exchange(g1, mv.swap)
+			}
+			if !ok {
+				continue
+			}
+			if gain.value < 0 && a.Rand.Float64() >= math.Exp(float64(gain.value)/temp) {
+				continue
+			}
+			m.apply(mv, gain)
+			value += gain.value
+			if value > bestValue {
+				bestValue = value
+				bestIteration, bestAt = stats.Iterations, time.Now()
+				copy(best, assignment)
+			}
+		}
+		copy(assignment, best)
+		score := st.fastHillClimb(assignment)
+		if tracker.add(assignment, score, st.rating(assignment, score)) {
+			stats.BestIteration, stats.BestFoundAfter = bestIteration, bestAt.Sub(start)
+		}
+	}
+	if progress != nil {
+		progress(Progress{Iterations: stats.Iterations, Total: total, BestScore: tracker.bestScore})
+	}
+	return Result{Solutions: tracker.results(st), Stats: stats}, nil
+}
+
+// startLocalSearch validates the problem and builds a first assignment and a
+// tracker holding it, which the restart-based strategies share.
+func startLocalSearch(p Problem) (*solverState, []int, *solutionTracker, error) {
+	if p.N == 0 {
+		return nil, nil, nil, ErrHardConflict
+	}
+	st := newSolverState(p)
+	if st.hasHardConflict() {
+		return nil, nil, nil, ErrHardConflict
+	}
+	assignment := make([]int, p.N)
+	if !st.initialPlacement(assignment) {
+		return nil, nil, nil, ErrInfeasible
+	}
+	score := st.score(assignment)
+	return st, assignment, newTracker(assignment, score, st.rating(assignment, score)), nil
+}
+
+// restart fills assignment with a fresh random placement, or with one of the
+// best solutions so far when the random placement does not fit.
+func (s *solverState) restart(assignment []int, tracker *solutionTracker, rng *rand.Rand) {
+	if s.randomPlacement(assignment, rng) {
+		return
+	}
+	copy(assignment, tracker.bestSolutions[rng.Intn(len(tracker.bestSolutions))])
+}
@@ -0,0 +1,36 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+)
+
+var (
+	ErrHardConflict = errors.New("hard conflicts exist, resolve before solving")
+	ErrInfeasible   = errors.New("no assignment satisfies the room capacities and hard constraints")
+)
+
+type Result struct {
+	Solutions []Solution
+	Optimal   bool
+	Bound     *int
+	Stats     Stats
+}
+
+type Solver interface {
+	Solve(ctx context.Context, p Problem, progress func(Progress)) (Result, error)
+}
+
+type Fast struct {
+	Params Params
+	Rand   *rand.Rand
+}
+
+func (f Fast) Solve(ctx context.Context, p Problem, progress func(Progress)) (Result, error) {
+	solutions, stats, err := solveFast(ctx, p, f.Params, f.Rand, progress)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Solutions: solutions, Stats: stats}, nil
+}
@@ -0,0 +1,64 @@
+package solver
+
+import "fmt"
+
+// CheckError explains why an assignment breaks a hard rule of its problem.
+type CheckError struct {
+	Reason   string
+	Students []int
+	Room     int
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%s (room %d, students %v)", e.Reason, e.Room+1, e.Students)
+}
+
+// Check reports the first hard rule the assignment breaks: every student must
+// be in a room, rooms must not overflow, pins, eligibility rules and must /
+// must_not constraints must hold.
+func (p Problem) Check(assignment []int) error {
+	if len(assignment) != p.N {
+		return &CheckError{Reason: fmt.Sprintf("assignment has %d students, want %d", len(assignment), p.N), Room: -1}
+	}
+	counts := make([]int, len(p.RoomSizes))
+	for i, room := range assignment {
+		if room < 0 || room >= len(p.RoomSizes) {
+			return &CheckError{Reason: "student is not in a room", Students: []int{i}, Room: -1}
+		}
+		counts[room]++
+	}
+	for room, count := range counts {
+		if count > p.RoomSizes[room] {
+			var members []int
+			for i, r := range assignment {
+				if r == room {
+					members = append(members, i)
+				}
+			}
+			return &CheckError{Reason: fmt.Sprintf("room holds %d but has %d students", p.RoomSizes[room], count), Students: members, Room: room}
+		}
+	}
+	for i, room := range assignment {
+		if pin, ok := p.Pinned[i]; ok && pin != room {
+			return &CheckError{Reason: "student is pinned to another room", Students: []int{i}, Room: room}
+		}
+		if i < len(p.Eligible) && p.Eligible[i] != nil && !p.Eligible[i][room] {
+			return &CheckError{Reason: "student is not eligible for this room", Students: []int{i}, Room: room}
+		}
+	}
+	for _, c := range p.Constraints {
+		sameRoom := assignment[c.StudentA] == assignment[c.StudentB]
+		switch {
+		case c.Kind == "must" && !sameRoom:
+			return &CheckError{Reason: "must-room-together students are apart", Students: []int{c.StudentA, c.StudentB}, Room: assignment[c.StudentA]}
+		case c.Kind == "must_not" && sameRoom:
+			return &CheckError{Reason: "must-not-room-together students share a room", Students: []int{c.StudentA, c.StudentB}, Room: assignment[c.StudentA]}
+		}
+	}
+	return nil
+}
+
+// Score is the total score the solvers give assignment.
+func (p Problem) Score(assignment []int) int {
+	return newSolverState(p).score(assignment)
+}
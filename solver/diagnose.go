@@ -0,0 +1,137 @@
+package solver
+
+import (
+	"slices"
+)
+
+const (
+	PlacementFound      = "found"
+	PlacementImpossible = "impossible"
+	PlacementUnknown    = "unknown"
+)
+
+// Diagnostics explains whether a problem can be solved at all. Groups and
+// cliques are lists of student indices.
+type Diagnostics struct {
+	Students        int
+	Capacity        int
+	LargestRoom     int
+	HardConflict    bool
+	OversizedGroups [][]int // must-together groups bigger than every room they may use
+	StrandedGroups  [][]int // must-together groups with no room they may use
+	ApartCliques    [][]int // students who must all be apart, in more must-together groups than there are rooms
+	Placement       string
+}
+
+func (d Diagnostics) Feasible() bool {
+	return !d.HardConflict && d.Students <= d.Capacity && len(d.OversizedGroups) == 0 &&
+		len(d.StrandedGroups) == 0 && len(d.ApartCliques) == 0 && d.Placement != PlacementImpossible
+}
+
+// Diagnose runs the cheap capacity checks and then searches for any placement
+// that fits, which settles bin-packing and must_not coloring together. The
+// search is bounded, so Placement may come back unknown on hard instances.
+func Diagnose(p Problem) Diagnostics {
+	d := Diagnostics{Students: p.N, Placement: PlacementFound}
+	for _, size := range p.RoomSizes {
+		d.Capacity += size
+		d.LargestRoom = max(d.LargestRoom, size)
+	}
+	if p.N == 0 {
+		return d
+	}
+	st := newSolverState(p)
+	d.HardConflict = st.hasHardConflict()
+	for _, members := range st.groupList {
+		root := st.groupOf[members[0]]
+		allowed, fits := false, false
+		for room := range st.numRooms {
+			if st.allowed(root, room) {
+				allowed = true
+				fits = fits || st.roomSizes[room] >= len(members)
+			}
+		}
+		switch {
+		case !allowed:
+			d.StrandedGroups = append(d.StrandedGroups, slices.Clone(members))
+		case !fits:
+			d.OversizedGroups = append(d.OversizedGroups, slices.Clone(members))
+		}
+	}
+	d.ApartCliques = st.apartCliques()
+
+	if !d.Feasible() {
+		d.Placement = PlacementImpossible
+		return d
+	}
+	found, complete := st.searchPlacement(make([]int, p.N), placementLimit)
+	switch {
+	case !found && complete:
+		d.Placement = PlacementImpossible
+	case !found:
+		d.Placement = PlacementUnknown
+	}
+	return d
+}
+
+// apartCliques looks for must-together groups that are pairwise kept apart by
+// must_nots and outnumber the rooms. Finding the largest clique is hard in
+// general, so this grows one greedily from each group, which catches the
+// cases that come up in practice.
+func (s *solverState) apartCliques() [][]int {
+	apart := map[[2]int]bool{}
+	degree := map[int]int{}
+	for p := range s.mustApart {
+		ga, gb := s.groupOf[p[0]], s.groupOf[p[1]]
+		if ga == gb || apart[[2]int{ga, gb}] {
+			continue
+		}
+		apart[[2]int{ga, gb}] = true
+		apart[[2]int{gb, ga}] = true
+		degree[ga]++
+		degree[gb]++
+	}
+	if len(degree) <= s.numRooms {
+		return nil
+	}
+	roots := make([]int, 0, len(degree))
+	for root := range degree {
+		roots = append(roots, root)
+	}
+	slices.SortFunc(roots, func(a, b int) int {
+		if degree[a] != degree[b] {
+			return degree[b] - degree[a]
+		}
+		return a - b
+	})
+
+	var cliques [][]int
+	seen := map[string]bool{}
+	for _, start := range roots {
+		if degree[start] < s.numRooms {
+			break
+		}
+		clique := []int{start}
+		for _, root := range roots {
+			if root == start {
+				continue
+			}
+			if !slices.ContainsFunc(clique, func(c int) bool { return !apart[[2]int{c, root}] }) {
+				clique = append(clique, root)
+			}
+		}
+		if len(clique) <= s.numRooms {
+			continue
+		}
+		var students []int
+		for _, root := range clique {
+			students = append(students, s.groups[root]...)
+		}
+		slices.Sort(students)
+		if key := normalizeKey(students); !seen[key] {
+			seen[key] = true
+			cliques = append(cliques, students)
+		}
+	}
+	return cliques
+}
@@ -0,0 +1,82 @@
+package solver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	must := func(a, b int) Constraint { return Constraint{a, b, "must", 0} }
+	mustNot := func(a, b int) Constraint { return Constraint{a, b, "must_not", 0} }
+	tests := []struct {
+		name      string
+		p         Problem
+		feasible  bool
+		placement string
+		oversized [][]int
+		stranded  [][]int
+		cliques   [][]int
+	}{
+		{
+			name:      "fits",
+			p:         Problem{N: 4, RoomSizes: []int{2, 2}},
+			feasible:  true,
+			placement: PlacementFound,
+		},
+		{
+			name:      "over capacity",
+			p:         Problem{N: 5, RoomSizes: []int{2, 2}},
+			placement: PlacementImpossible,
+		},
+		{
+			name:      "oversized must group",
+			p:         Problem{N: 4, RoomSizes: []int{2, 2}, Constraints: []Constraint{must(0, 1), must(1, 2)}},
+			placement: PlacementImpossible,
+			oversized: [][]int{{0, 1, 2}},
+		},
+		{
+			name: "group stranded by eligibility",
+			p: Problem{N: 4, RoomSizes: []int{2, 2}, Constraints: []Constraint{must(0, 1)},
+				Eligible: [][]bool{{true, false}, {false, true}, nil, nil}},
+			placement: PlacementImpossible,
+			stranded:  [][]int{{0, 1}},
+		},
+		{
+			name: "must_not clique larger than the room count",
+			p: Problem{N: 6, RoomSizes: []int{3, 3}, Constraints: []Constraint{
+				mustNot(0, 1), mustNot(0, 2), mustNot(1, 2)}},
+			placement: PlacementImpossible,
+			cliques:   [][]int{{0, 1, 2}},
+		},
+		{
+			name: "packing that fits only one way",
+			p: Problem{N: 5, RoomSizes: []int{2, 3}, Constraints: []Constraint{
+				must(0, 1), must(1, 2), must(3, 4)}},
+			feasible:  true,
+			placement: PlacementFound,
+		},
+		{
+			name: "packing that does not fit",
+			p: Problem{N: 6, RoomSizes: []int{3, 3}, Constraints: []Constraint{
+				must(0, 1), must(2, 3), must(4, 5)}},
+			placement: PlacementImpossible,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Diagnose(tt.p)
+			if d.Feasible() != tt.feasible || d.Placement != tt.placement {
+				t.Errorf("feasible %v, placement %q; want %v, %q (%+v)", d.Feasible(), d.Placement, tt.feasible, tt.placement, d)
+			}
+			if !reflect.DeepEqual(d.OversizedGroups, tt.oversized) {
+				t.Errorf("oversized groups %v, want %v", d.OversizedGroups, tt.oversized)
+			}
+			if !reflect.DeepEqual(d.StrandedGroups, tt.stranded) {
+				t.Errorf("stranded groups %v, want %v", d.StrandedGroups, tt.stranded)
+			}
+			if !reflect.DeepEqual(d.ApartCliques, tt.cliques) {
+				t.Errorf("apart cliques %v, want %v", d.ApartCliques, tt.cliques)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+const ExactMaxStudents = 40
+
+var ErrExactObjective = errors.New("the exact solver only supports the sum objective")
+
+// Exact is a depth-first branch-and-bound over must-together groups. It is
+// warm-started from a short SolveFast run, prunes any subtree whose optimistic
+// bound cannot beat the incumbent, and breaks symmetry between interchangeable
+// rooms. If ctx ends first, the result carries the best solution found and an
+// upper bound on the optimum instead of an optimality proof.
+type Exact struct {
+	MaxStudents int
+}
+
+func (e Exact) Solve(ctx context.Context, p Problem, progress func(Progress)) (Result, error) {
+	maxStudents := e.MaxStudents
+	if maxStudents == 0 {
+		maxStudents = ExactMaxStudents
+	}
+	if p.N > maxStudents {
+		return Result{}, fmt.Errorf("the exact solver supports at most %d students", maxStudents)
+	}
+	if p.Objective != "" && p.Objective != ObjectiveSum {
+		return Result{}, ErrExactObjective
+	}
+	if p.N == 0 {
+		return Result{}, ErrHardConflict
+	}
+	st := newSolverState(p)
+	if st.hasHardConflict() {
+		return Result{}, ErrHardConflict
+	}
+
+	b := &branchAndBound{
+		ctx:        ctx,
+		start:      time.Now(),
+		s:          st,
+		progress:   progress,
+		assignment: make([]int, p.N),
+		roomCap:    slices.Clone(st.roomSizes),
+		best:       math.MinInt,
+		openBound:  math.MinInt,
+		satisfied:  make([]int, p.N),
+		possible:   make([][]int, p.N),
+	}
+	for i := range b.assignment {
+		b.assignment[i] = -1
+	}
+	b.roomClass = st.roomClasses()
+	b.order = st.branchOrder()
+
+	warm := SolveFast(ctx, p, Params{NumRandom: 20, NumPerturb: 200, PerturbMin: 3, PerturbMax: 8}, rand.New(rand.NewSource(1)), nil)
+	for _, sol := range warm {
+		if st.valid(sol.Assignment) {
+			b.best = sol.Score
+			b.solutions = append(b.solutions, sol)
+			b.stats.BestFoundAfter = time.Since(b.start)
+		}
+	}
+
+	rootBound := b.bound()
+	aborted := b.search(0, rootBound)
+	if len(b.solutions) == 0 {
+		if aborted {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, ErrInfeasible
+	}
+	bound := b.best
+	if aborted {
+		bound = max(bound, b.openBound)
+	}
+	b.stats.Iterations = b.nodes
+	return Result{Solutions: b.solutions, Optimal: !aborted, Bound: &bound, Stats: b.stats}, nil
+}
+
+type branchAndBound struct {
+	ctx        context.Context
+	start      time.Time
+	stats      Stats
+	s          *solverState
+	progress   func(Progress)
+	assignment []int
+	roomCap    []int
+	roomClass  []int
+	order      []int
+	best       int
+	solutions  []Solution
+	openBound  int
+	nodes      int
+	satisfied  []int
+	possible   [][]int
+	roots      []int
+	free       []int
+}
+
+type branch struct {
+	room  int
+	bound int
+}
+
+func (b *branchAndBound) search(gi int, nodeBound int) bool {
+	b.nodes++
+	if b.nodes%1024 == 0 {
+		if b.ctx.Err() != nil {
+			b.openBound = max(b.openBound, nodeBound)
+			return true
+		}
+		if b.progress != nil {
+			b.progress(Progress{Iterations: b.nodes, BestScore: b.best})
+		}
+	}
+	s := b.s
+	if gi == len(b.order) {
+		score := nodeBound
+		if s.fill.active() {
+			score = s.score(b.assignment)
+		}
+		if score > b.best {
+			b.best = score
+			b.solutions = []Solution{{Assignment: slices.Clone(b.assignment), Score: score}}
+			b.stats.BestIteration, b.stats.BestFoundAfter = b.nodes, time.Since(b.start)
+		}
+		return false
+	}
+
+	root := b.order[gi]
+	grp := s.groups[root]
+	var branches []branch
+	for room := range s.numRooms {
+		if !b.canPlace(grp, root, room) {
+			continue
+		}
+		b.place(grp, room)
+		branches = append(branches, branch{room, b.bound()})
+		b.unplace(grp, room)
+	}
+	slices.SortStableFunc(branches, func(x, y branch) int { return y.bound - x.bound })
+
+	for i, br := range branches {
+		if br.bound <= b.best {
+			break
+		}
+		b.place(grp, br.room)
+		aborted := b.search(gi+1, br.bound)
+		b.unplace(grp, br.room)
+		if aborted {
+			for _, rest := range branches[i+1:] {
+				if rest.bound > b.best {
+					b.openBound = max(b.openBound, rest.bound)
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (b *branchAndBound) canPlace(grp []int, root, room int) bool {
+	s := b.s
+	if b.roomCap[room] < len(grp) || !s.allowed(root, room) {
+		return false
+	}
+	if b.roomCap[room] == s.roomSizes[room] && s.emptyTwin(room, b.roomClass, b.roomCap) {
+		return false
+	}
+	for _, m := range grp {
+		for _, partner := range s.mustApartFor[m] {
+			if b.assignment[partner] == room {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (b *branchAndBound) place(grp []int, room int) {
+	for _, m := range grp {
+		b.assignment[m] = room
+	}
+	b.roomCap[room] -= len(grp)
+}
+
+func (b *branchAndBound) unplace(grp []int, room int) {
+	for _, m := range grp {
+		b.assignment[m] = -1
+	}
+	b.roomCap[room] += len(grp)
+}
+
+// bound is an upper bound on the score of any completion of the current
+// partial assignment. Each student is credited with the prefers already
+// satisfied plus the heaviest still-possible ones that fit in their room;
+// prefer_nots only count once both students are placed together. Room fill
+// costs are left out, which keeps the bound valid but looser.
+func (b *branchAndBound) bound() int {
+	s := b.s
+	a := b.assignment
+	total := 0
+	satisfied, possible := b.satisfied, b.possible
+	for i := range s.n {
+		satisfied[i] = 0
+		possible[i] = possible[i][:0]
+	}
+	for _, c := range s.constraints {
+		ra, rb := a[c.StudentA], a[c.StudentB]
+		switch c.Kind {
+		case "prefer":
+			switch {
+			case ra >= 0 && ra == rb:
+				total += c.Weight
+				satisfied[c.StudentA]++
+			case ra >= 0 && rb >= 0:
+			case ra >= 0 && !b.canJoin(c.StudentB, ra):
+			case ra < 0:
+			default:
+				possible[c.StudentA] = append(possible[c.StudentA], c.Weight)
+			}
+		case "prefer_not":
+			if ra >= 0 && ra == rb {
+				total -= s.pnMultiple
+			}
+		}
+	}
+	for i := range s.n {
+		if a[i] < 0 {
+			continue
+		}
+		weights := possible[i]
+		slots := min(len(weights), b.roomCap[a[i]])
+		if slots < len(weights) {
+			slices.SortFunc(weights, func(x, y int) int { return y - x })
+		}
+		for _, w := range weights[:slots] {
+			total += w
+		}
+		if s.hasPrefer[i] && satisfied[i] == 0 && slots == 0 {
+			total -= s.npCost
+		}
+	}
+	for _, root := range b.unplacedRoots() {
+		for _, i := range s.groups[root] {
+			if s.hasPrefer[i] {
+				total += b.unplacedBound(i, root)
+			}
+		}
+	}
+	return total
+}
+
+func (b *branchAndBound) unplacedRoots() []int {
+	roots := b.roots[:0]
+	for _, root := range b.s.uniqueGroups {
+		if b.assignment[root] < 0 {
+			roots = append(roots, root)
+		}
+	}
+	b.roots = roots
+	return roots
+}
+
+// unplacedBound is the most an unplaced student can still score from their
+// prefers: the best room they could join, counting partners already there,
+// group mates who come along anyway, and the heaviest unplaced partners that
+// fit in the space left.
+func (b *branchAndBound) unplacedBound(i, root int) int {
+	s := b.s
+	a := b.assignment
+	size := len(s.groups[root])
+	best := math.MinInt
+	for room := range s.numRooms {
+		if b.roomCap[room] < size || !s.allowed(root, room) {
+			continue
+		}
+		sc, got := 0, false
+		free := b.free[:0]
+		for _, ci := range s.preferFrom[i] {
+			c := s.constraints[ci]
+			switch {
+			case s.groupOf[c.StudentB] == root || a[c.StudentB] == room:
+				sc += c.Weight
+				got = true
+			case a[c.StudentB] < 0:
+				free = append(free, c.Weight)
+			}
+		}
+		slots := min(len(free), b.roomCap[room]-size)
+		if slots < len(free) {
+			slices.SortFunc(free, func(x, y int) int { return y - x })
+		}
+		for _, w := range free[:slots] {
+			sc += w
+			got = true
+		}
+		b.free = free
+		if !got {
+			sc -= s.npCost
+		}
+		best = max(best, sc)
+	}
+	if best == math.MinInt {
+		return -s.npCost
+	}
+	return best
+}
+
+func (b *branchAndBound) canJoin(student, room int) bool {
+	root := b.s.groupOf[student]
+	return b.roomCap[room] >= len(b.s.groups[root]) && b.s.allowed(root, room)
+}
+
+// branchOrder places groups so that each one is as connected as possible to
+// the groups already placed, which lets prefer and prefer_not pairs resolve
+// early and tightens the bound. Ties go to the most constrained group.
+func (s *solverState) branchOrder() []int {
+	links := map[[2]int]int{}
+	degree := map[int]int{}
+	for _, c := range s.constraints {
+		ga, gb := s.groupOf[c.StudentA], s.groupOf[c.StudentB]
+		if ga == gb {
+			continue
+		}
+		links[[2]int{ga, gb}]++
+		links[[2]int{gb, ga}]++
+		degree[ga]++
+		degree[gb]++
+	}
+	placed := map[int]bool{}
+	var order []int
+	for len(order) < len(s.groupList) {
+		bestRoot, bestLinks := -1, -1
+		for _, members := range s.groupList {
+			root := s.groupOf[members[0]]
+			if placed[root] {
+				continue
+			}
+			l := 0
+			for _, other := range order {
+				l += links[[2]int{root, other}]
+			}
+			if l > bestLinks || (l == bestLinks && degree[root] > degree[bestRoot]) {
+				bestRoot, bestLinks = root, l
+			}
+		}
+		placed[bestRoot] = true
+		order = append(order, bestRoot)
+	}
+	return order
+}
+
+// roomClasses labels rooms that no constraint can tell apart: same capacity
+// and the same allowed groups. Filling such rooms in index order is enough to
+// visit every distinct assignment once.
+func (s *solverState) roomClasses() []int {
+	class := make([]int, s.numRooms)
+	for room := range s.numRooms {
+		class[room] = room
+		for prev := range room {
+			if class[prev] != prev || s.roomSizes[prev] != s.roomSizes[room] {
+				continue
+			}
+			same := true
+			for root := range s.groupRooms {
+				if s.allowed(root, prev) != s.allowed(root, room) {
+					same = false
+					break
+				}
+			}
+			if same {
+				class[room] = prev
+				break
+			}
+		}
+	}
+	return class
+}
+
+func (s *solverState) valid(assignment []int) bool {
+	counts := make([]int, s.numRooms)
+	for i, room := range assignment {
+		if room < 0 || room >= s.numRooms || !s.allowed(s.groupOf[i], room) {
+			return false
+		}
+		if assignment[s.groupOf[i]] != room {
+			return false
+		}
+		counts[room]++
+	}
+	for room, c := range counts {
+		if c > s.roomSizes[room] {
+			return false
+		}
+	}
+	for p := range s.mustApart {
+		if assignment[p[0]] == assignment[p[1]] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// bruteForce enumerates every assignment of p and returns the best score of
+// those that pass Check.
+func bruteForce(p Problem) (best int, found bool) {
+	a := make([]int, p.N)
+	var walk func(i int)
+	walk = func(i int) {
+		if i == p.N {
+			if p.Check(a) == nil {
+				if sc := p.Score(a); !found || sc > best {
+					best, found = sc, true
+				}
+			}
+			return
+		}
+		for room := range p.RoomSizes {
+			a[i] = room
+			walk(i + 1)
+		}
+	}
+	walk(0)
+	return best, found
+}
+
+// randomSmallProblem builds a problem small enough to enumerate, with ranked
+// prefers, hard constraints, pins, eligibility rules and room fill costs.
+func randomSmallProblem(rng *rand.Rand) Problem {
+	kinds := []string{"prefer", "prefer", "prefer", "prefer_not", "must", "must_not"}
+	n := 5 + rng.Intn(3)
+	sizes := [][]int{{3, 3, 2}, {2, 2, 2, 2}, {4, 3}}[rng.Intn(3)]
+	p := Problem{N: n, RoomSizes: sizes, PreferNotMultiple: 1 + rng.Intn(5), NoPreferCost: rng.Intn(5)}
+	for range n + rng.Intn(n) {
+		a, b := rng.Intn(n), rng.Intn(n)
+		if a != b {
+			p.Constraints = append(p.Constraints, Constraint{a, b, kinds[rng.Intn(len(kinds))], rng.Intn(4)})
+		}
+	}
+	if rng.Intn(2) == 0 {
+		p.Pinned = map[int]int{rng.Intn(n): rng.Intn(len(sizes))}
+	}
+	if rng.Intn(2) == 0 {
+		p.Eligible = make([][]bool, n)
+		for i := range rng.Intn(n) {
+			p.Eligible[i] = make([]bool, len(sizes))
+			for room := range sizes {
+				p.Eligible[i][room] = rng.Intn(3) > 0
+			}
+		}
+	}
+	if rng.Intn(3) == 0 {
+		p.SingletonCost, p.MinOccupancy, p.UnderfillCost, p.ImbalanceCost = rng.Intn(4), 2, rng.Intn(3), rng.Intn(2)
+	}
+	return p
+}
+
+func TestExactMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	for trial := range 200 {
+		p := randomSmallProblem(rng)
+		want, feasible := bruteForce(p)
+		res, err := Exact{}.Solve(context.Background(), p, nil)
+		if !feasible {
+			if err == nil {
+				t.Fatalf("trial %d: infeasible problem solved with score %d", trial, res.Solutions[0].Score)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("trial %d: %v, want score %d", trial, err, want)
+		}
+		if !res.Optimal || res.Bound == nil || *res.Bound != want {
+			t.Fatalf("trial %d: optimal %v bound %v, want an optimal result bounded by %d", trial, res.Optimal, res.Bound, want)
+		}
+		for _, sol := range res.Solutions {
+			if err := p.Check(sol.Assignment); err != nil {
+				t.Fatalf("trial %d: %v in %v", trial, err, sol.Assignment)
+			}
+			if sol.Score != want || p.Score(sol.Assignment) != want {
+				t.Fatalf("trial %d: solution %v scores %d (reported %d), want %d", trial, sol.Assignment, p.Score(sol.Assignment), sol.Score, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package solver
+
+type StudentExplanation struct {
+	Student            int
+	Room               int
+	Score              int
+	PrefersSatisfied   []int
+	PrefersUnsatisfied []int
+	PreferNotsViolated []int
+	NoPreferPenalty    bool
+}
+
+type RoomExplanation struct {
+	Room        int
+	Score       int
+	FillPenalty int
+	Students    []int
+}
+
+type Explanation struct {
+	Score    int
+	Students []StudentExplanation
+	Rooms    []RoomExplanation
+}
+
+// Explain attributes the score of an assignment to individual students and
+// rooms. Each prefer or prefer_not counts toward the student who expressed it
+// (StudentA), so student scores plus room fill penalties add up to room
+// scores and to the total.
+func (p Problem) Explain(assignment []int) Explanation {
+	ex := Explanation{
+		Students: make([]StudentExplanation, p.N),
+		Rooms:    make([]RoomExplanation, len(p.RoomSizes)),
+	}
+	for i := range p.N {
+		ex.Students[i].Student = i
+		ex.Students[i].Room = assignment[i]
+	}
+	hasPrefer := make([]bool, p.N)
+	for _, c := range p.Constraints {
+		st := &ex.Students[c.StudentA]
+		sameRoom := assignment[c.StudentA] == assignment[c.StudentB]
+		switch c.Kind {
+		case "prefer":
+			hasPrefer[c.StudentA] = true
+			if sameRoom {
+				st.Score += max(c.Weight, 1)
+				st.PrefersSatisfied = append(st.PrefersSatisfied, c.StudentB)
+			} else {
+				st.PrefersUnsatisfied = append(st.PrefersUnsatisfied, c.StudentB)
+			}
+		case "prefer_not":
+			if sameRoom {
+				st.Score -= p.PreferNotMultiple
+				st.PreferNotsViolated = append(st.PreferNotsViolated, c.StudentB)
+			}
+		}
+	}
+	for i := range ex.Rooms {
+		ex.Rooms[i].Room = i
+	}
+	for i := range ex.Students {
+		st := &ex.Students[i]
+		if hasPrefer[i] && len(st.PrefersSatisfied) == 0 {
+			st.NoPreferPenalty = true
+			st.Score -= p.NoPreferCost
+		}
+		room := &ex.Rooms[st.Room]
+		room.Score += st.Score
+		room.Students = append(room.Students, i)
+		ex.Score += st.Score
+	}
+	fill := p.roomFill()
+	if fill.active() {
+		for i := range ex.Rooms {
+			room := &ex.Rooms[i]
+			room.FillPenalty = fill.cost(p.RoomSizes[i], len(room.Students))
+			room.Score -= room.FillPenalty
+			ex.Score -= room.FillPenalty
+		}
+	}
+	return ex
+}
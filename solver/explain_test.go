@@ -0,0 +1,50 @@
+package solver
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestExplainAddsUpToScore(t *testing.T) {
+	rng := rand.New(rand.NewSource(13))
+	kinds := []string{"prefer", "prefer", "prefer_not", "must", "must_not"}
+	for trial := range 200 {
+		n := 6 + rng.Intn(10)
+		sizes := []int{4, 4, 3, 3, 2}
+		p := Problem{N: n, RoomSizes: sizes, PreferNotMultiple: 1 + rng.Intn(5), NoPreferCost: rng.Intn(8)}
+		for range 2 * n {
+			if a, b := rng.Intn(n), rng.Intn(n); a != b {
+				p.Constraints = append(p.Constraints, Constraint{a, b, kinds[rng.Intn(len(kinds))], rng.Intn(4)})
+			}
+		}
+		if trial%2 == 0 {
+			p.SingletonCost, p.MinOccupancy, p.UnderfillCost, p.ImbalanceCost = rng.Intn(5), 1+rng.Intn(3), rng.Intn(4), rng.Intn(3)
+		}
+		a := make([]int, n)
+		for i := range a {
+			a[i] = rng.Intn(len(sizes))
+		}
+
+		ex := p.Explain(a)
+		if want := p.Score(a); ex.Score != want {
+			t.Fatalf("trial %d: Explain score %d, Score %d", trial, ex.Score, want)
+		}
+		roomTotal := 0
+		for _, room := range ex.Rooms {
+			sum := -room.FillPenalty
+			for _, i := range room.Students {
+				if ex.Students[i].Room != room.Room {
+					t.Fatalf("trial %d: student %d listed in room %d but placed in %d", trial, i, room.Room, ex.Students[i].Room)
+				}
+				sum += ex.Students[i].Score
+			}
+			if room.Score != sum {
+				t.Fatalf("trial %d: room %d scores %d, its students and fill penalty add up to %d", trial, room.Room, room.Score, sum)
+			}
+			roomTotal += room.Score
+		}
+		if roomTotal != ex.Score {
+			t.Fatalf("trial %d: room scores add up to %d, total is %d", trial, roomTotal, ex.Score)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package solver
+
+// roomFill prices how rooms are filled: a student on their own, a room below
+// the minimum occupancy, and vacancies spread unevenly across rooms. These
+// costs belong to rooms rather than students, so they count toward the total
+// score but not toward any one student's score.
+type roomFill struct {
+	singleton    int
+	minOccupancy int
+	underfill    int
+	imbalance    int
+}
+
+func (p Problem) roomFill() roomFill {
+	return roomFill{
+		singleton:    p.SingletonCost,
+		minOccupancy: p.MinOccupancy,
+		underfill:    p.UnderfillCost,
+		imbalance:    p.ImbalanceCost,
+	}
+}
+
+func (f roomFill) active() bool {
+	return f.singleton > 0 || (f.minOccupancy > 0 && f.underfill > 0) || f.imbalance > 0
+}
+
+// cost is the penalty for a room of the given size holding count students.
+// Empty rooms are never under-filled, but squaring the vacancy still makes two
+// half-empty rooms cheaper than a full one next to an empty one.
+func (f roomFill) cost(size, count int) int {
+	c := 0
+	if count == 1 {
+		c += f.singleton
+	}
+	if count > 0 && count < f.minOccupancy {
+		c += f.underfill * (f.minOccupancy - count)
+	}
+	vacancy := size - count
+	return c + f.imbalance*vacancy*vacancy
+}
+
+func (f roomFill) total(roomSizes []int, assignment []int) int {
+	counts := make([]int, len(roomSizes))
+	for _, room := range assignment {
+		counts[room]++
+	}
+	c := 0
+	for room, size := range roomSizes {
+		c += f.cost(size, counts[room])
+	}
+	return c
+}
+
+// fillDelta is the score change from moving k students out of oldRoom and
+// into newRoom, given the current room counts.
+func (s *solverState) fillDelta(roomCounts []int, k, oldRoom, newRoom int) int {
+	f := s.fill
+	oldSize, newSize := s.roomSizes[oldRoom], s.roomSizes[newRoom]
+	oldCount, newCount := roomCounts[oldRoom], roomCounts[newRoom]
+	return f.cost(oldSize, oldCount) - f.cost(oldSize, oldCount-k) +
+		f.cost(newSize, newCount) - f.cost(newSize, newCount+k)
+}
@@ -0,0 +1,42 @@
+package solver
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFillDeltaMatchesRecomputation(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	sizes := []int{4, 4, 3, 2, 2}
+	p := Problem{N: 12, RoomSizes: sizes, SingletonCost: 7, MinOccupancy: 3, UnderfillCost: 4, ImbalanceCost: 2}
+	s := newSolverState(p)
+	a := []int{0, 0, 0, 1, 1, 1, 2, 2, 3, 3, 4, 4}
+	counts := make([]int, len(sizes))
+	for _, room := range a {
+		counts[room]++
+	}
+	score := s.score(a)
+	for move := range 2000 {
+		oldRoom, newRoom := rng.Intn(len(sizes)), rng.Intn(len(sizes))
+		if oldRoom == newRoom || counts[oldRoom] == 0 {
+			continue
+		}
+		k := 1 + rng.Intn(min(counts[oldRoom], sizes[newRoom]-counts[newRoom]+1))
+		if counts[newRoom]+k > sizes[newRoom] {
+			continue
+		}
+		score += s.fillDelta(counts, k, oldRoom, newRoom)
+		moved := 0
+		for i := range a {
+			if a[i] == oldRoom && moved < k {
+				a[i] = newRoom
+				moved++
+			}
+		}
+		counts[oldRoom] -= k
+		counts[newRoom] += k
+		if want := s.score(a); score != want {
+			t.Fatalf("move %d: accumulated score %d, recomputed %d", move, score, want)
+		}
+	}
+}
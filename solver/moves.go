@@ -0,0 +1,359 @@
+package solver
+
+// moveState keeps an assignment together with the incremental bookkeeping
+// the local search strategies need to score single-group moves and swaps
+// without rescoring the whole assignment.
+type moveState struct {
+	s            *solverState
+	assignment   []int
+	score        int
+	roomCounts   []int
+	prefSatCount []int
+	memberSet    []bool
+	npAffected   map[int]int
+
+	fair         bool
+	studentScore []int
+	scoreHist    map[int]int
+	lowest       int
+	lowestValid  bool
+	changes      *studentDeltas
+	swapChanges  *studentDeltas
+}
+
+// move relocates group to room, or swaps it with swap when swap is set.
+type move struct {
+	group int
+	room  int
+	swap  int
+}
+
+func (s *solverState) newMoveState(assignment []int) *moveState {
+	m := &moveState{
+		s:            s,
+		assignment:   assignment,
+		roomCounts:   make([]int, s.numRooms),
+		prefSatCount: make([]int, s.n),
+		memberSet:    make([]bool, s.n),
+		npAffected:   map[int]int{},
+		fair:         s.objective != ObjectiveSum,
+		scoreHist:    map[int]int{},
+		changes:      newStudentDeltas(s.n),
+		swapChanges:  newStudentDeltas(s.n),
+	}
+	m.reset()
+	return m
+}
+
+// reset recomputes the bookkeeping after the assignment was changed directly.
+func (m *moveState) reset() {
+	s := m.s
+	clear(m.roomCounts)
+	for _, room := range m.assignment {
+		m.roomCounts[room]++
+	}
+	clear(m.prefSatCount)
+	for _, c := range s.constraints {
+		if c.Kind == "prefer" && m.assignment[c.StudentA] == m.assignment[c.StudentB] {
+			m.prefSatCount[c.StudentA]++
+		}
+	}
+	m.score = s.score(m.assignment)
+	clear(m.scoreHist)
+	m.lowestValid = false
+	if m.fair {
+		m.studentScore = s.studentScores(m.assignment)
+		for _, v := range m.studentScore {
+			m.scoreHist[v]++
+		}
+	}
+}
+
+func (m *moveState) shiftHist(ch *studentDeltas, sign int) {
+	for _, st := range ch.touched {
+		d := ch.delta[st]
+		if d == 0 {
+			continue
+		}
+		from, to := m.studentScore[st], m.studentScore[st]+d
+		if sign < 0 {
+			from, to = to, from
+		}
+		m.lowestValid = false
+		if m.scoreHist[from]--; m.scoreHist[from] == 0 {
+			delete(m.scoreHist, from)
+		}
+		m.scoreHist[to]++
+	}
+}
+
+func (m *moveState) minScore() int {
+	if m.lowestValid {
+		return m.lowest
+	}
+	first := true
+	for v := range m.scoreHist {
+		if first || v < m.lowest {
+			m.lowest, first = v, false
+		}
+	}
+	m.lowestValid = true
+	return m.lowest
+}
+
+// evaluate turns a score delta and the per-student changes behind it into a
+// gain under the objective. For maxmin the value is a scalar stand-in that
+// weighs a change of the minimum by the number of students, which is what
+// strategies that need a magnitude (annealing) use.
+func (m *moveState) evaluate(delta int, ch *studentDeltas) moveGain {
+	s := m.s
+	g := moveGain{delta: delta, value: delta}
+	if !m.fair {
+		return g
+	}
+	low := m.minScore()
+	after, leavingLow := low, 0
+	for _, st := range ch.touched {
+		if d := ch.delta[st]; d != 0 {
+			if m.studentScore[st] == low {
+				leavingLow++
+			}
+			after = min(after, m.studentScore[st]+d)
+		}
+	}
+	if leavingLow == m.scoreHist[low] && after == low {
+		m.shiftHist(ch, 1)
+		after = m.minScore()
+		m.shiftHist(ch, -1)
+	}
+	switch s.objective {
+	case ObjectiveHybrid:
+		g.value += s.fairWeight * (after - low)
+	case ObjectiveMaxMin:
+		g.value += s.n * (after - low)
+		for _, st := range ch.touched {
+			if d := ch.delta[st]; d != 0 {
+				g.removed = append(g.removed, m.studentScore[st])
+				g.added = append(g.added, m.studentScore[st]+d)
+			}
+		}
+	}
+	return g
+}
+
+// delta is the score change of moving groupRoot from oldRoom to newRoom. In
+// fair mode it also leaves the per-student changes in m.changes.
+func (m *moveState) delta(groupRoot int, oldRoom, newRoom int) int {
+	s := m.s
+	members := s.groups[groupRoot]
+	for _, mem := range members {
+		m.memberSet[mem] = true
+	}
+
+	delta := 0
+	clear(m.npAffected)
+	if m.fair {
+		m.changes.reset()
+	}
+
+	for _, mem := range members {
+		for _, ci := range s.studentConstraints[mem] {
+			c := s.constraints[ci]
+			other := c.StudentB
+			if other == mem {
+				other = c.StudentA
+			}
+			if m.memberSet[other] {
+				continue
+			}
+			otherRoom := m.assignment[other]
+			wasSame := otherRoom == oldRoom
+			willBeSame := otherRoom == newRoom
+			if wasSame == willBeSame {
+				continue
+			}
+			d := 0
+			switch c.Kind {
+			case "prefer":
+				if wasSame {
+					d = -c.Weight
+					m.npAffected[c.StudentA]--
+				} else {
+					d = c.Weight
+					m.npAffected[c.StudentA]++
+				}
+			case "prefer_not":
+				if wasSame {
+					d = s.pnMultiple
+				} else {
+					d = -s.pnMultiple
+				}
+			}
+			delta += d
+			if m.fair {
+				m.changes.add(c.StudentA, d)
+			}
+		}
+	}
+
+	for student, change := range m.npAffected {
+		if !s.hasPrefer[student] {
+			continue
+		}
+		wasSat := m.prefSatCount[student] > 0
+		willBeSat := m.prefSatCount[student]+change > 0
+		d := 0
+		if wasSat && !willBeSat {
+			d = -s.npCost
+		} else if !wasSat && willBeSat {
+			d = s.npCost
+		}
+		delta += d
+		if m.fair {
+			m.changes.add(student, d)
+		}
+	}
+
+	for _, mem := range members {
+		m.memberSet[mem] = false
+	}
+	if s.fill.active() {
+		delta += s.fillDelta(m.roomCounts, len(members), oldRoom, newRoom)
+	}
+	return delta
+}
+
+// shift moves groupRoot and updates the bookkeeping, except for m.score,
+// which callers adjust by the delta they already computed.
+func (m *moveState) shift(groupRoot int, oldRoom, newRoom int) {
+	s := m.s
+	if m.fair {
+		m.delta(groupRoot, oldRoom, newRoom)
+		m.shiftHist(m.changes, 1)
+		for _, st := range m.changes.touched {
+			m.studentScore[st] += m.changes.delta[st]
+		}
+	}
+	members := s.groups[groupRoot]
+	for _, mem := range members {
+		m.memberSet[mem] = true
+	}
+	for _, mem := range members {
+		for _, ci := range s.studentConstraints[mem] {
+			c := s.constraints[ci]
+			other := c.StudentB
+			if other == mem {
+				other = c.StudentA
+			}
+			if m.memberSet[other] {
+				continue
+			}
+			otherRoom := m.assignment[other]
+			wasSame := otherRoom == oldRoom
+			willBeSame := otherRoom == newRoom
+			if wasSame == willBeSame {
+				continue
+			}
+			if c.Kind == "prefer" {
+				if wasSame {
+					m.prefSatCount[c.StudentA]--
+				} else {
+					m.prefSatCount[c.StudentA]++
+				}
+			}
+		}
+	}
+	m.roomCounts[oldRoom] -= len(members)
+	for _, mem := range members {
+		m.assignment[mem] = newRoom
+	}
+	m.roomCounts[newRoom] += len(members)
+	for _, mem := range members {
+		m.memberSet[mem] = false
+	}
+}
+
+func (m *moveState) room(groupRoot int) int {
+	return m.assignment[m.s.groups[groupRoot][0]]
+}
+
+// relocation scores moving group gRoot into room; ok is false if the room
+// cannot take it.
+func (m *moveState) relocation(gRoot, room int) (moveGain, bool) {
+	s := m.s
+	gRoom := m.room(gRoot)
+	if room == gRoom || m.roomCounts[room]+len(s.groups[gRoot]) > s.roomSizes[room] {
+		return moveGain{}, false
+	}
+	if !s.feasibleForGroup(m.assignment, gRoot, room) {
+		return moveGain{}, false
+	}
+	return m.evaluate(m.delta(gRoot, gRoom, room), m.changes), true
+}
+
+// exchange scores swapping the rooms of groups gRoot and g2Root.
+func (m *moveState) exchange(gRoot, g2Root int) (moveGain, bool) {
+	s := m.s
+	grp, grp2 := s.groups[gRoot], s.groups[g2Root]
+	gRoom, g2Room := m.assignment[grp[0]], m.assignment[grp2[0]]
+	if gRoom == g2Room {
+		return moveGain{}, false
+	}
+	newGRoom := m.roomCounts[gRoom] - len(grp) + len(grp2)
+	newG2Room := m.roomCounts[g2Room] - len(grp2) + len(grp)
+	if newGRoom > s.roomSizes[gRoom] || newG2Room > s.roomSizes[g2Room] {
+		return moveGain{}, false
+	}
+	if !s.feasibleForGroup(m.assignment, gRoot, g2Room) {
+		return moveGain{}, false
+	}
+	delta1 := m.delta(gRoot, gRoom, g2Room)
+	if m.fair {
+		m.swapChanges.reset()
+		for _, st := range m.changes.touched {
+			m.swapChanges.add(st, m.changes.delta[st])
+		}
+	}
+	m.shift(gRoot, gRoom, g2Room)
+	if !s.feasibleForGroup(m.assignment, g2Root, gRoom) {
+		m.shift(gRoot, g2Room, gRoom)
+		return moveGain{}, false
+	}
+	delta2 := m.delta(g2Root, g2Room, gRoom)
+	if m.fair {
+		for _, st := range m.changes.touched {
+			m.swapChanges.add(st, m.changes.delta[st])
+		}
+	}
+	m.shift(gRoot, g2Room, gRoom)
+	return m.evaluate(delta1+delta2, m.swapChanges), true
+}
+
+// neighbors calls fn for every feasible relocation and swap, in a fixed order.
+func (m *moveState) neighbors(fn func(mv move, g moveGain)) {
+	s := m.s
+	for gi, gRoot := range s.uniqueGroups {
+		for room := range s.numRooms {
+			if g, ok := m.relocation(gRoot, room); ok {
+				fn(move{group: gRoot, room: room, swap: -1}, g)
+			}
+		}
+		for _, g2Root := range s.uniqueGroups[gi+1:] {
+			if g, ok := m.exchange(gRoot, g2Root); ok {
+				fn(move{group: gRoot, room: -1, swap: g2Root}, g)
+			}
+		}
+	}
+}
+
+func (m *moveState) apply(mv move, g moveGain) {
+	gRoom := m.room(mv.group)
+	if mv.swap < 0 {
+		m.shift(mv.group, gRoom, mv.room)
+	} else {
+		g2Room := m.room(mv.swap)
+		m.shift(mv.group, gRoom, g2Room)
+		m.shift(mv.swap, g2Room, gRoom)
+	}
+	m.score += g.delta
+}
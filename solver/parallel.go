@@ -0,0 +1,99 @@
+package solver
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// parallelRound is how many perturbations each worker chains between merges.
+const parallelRound = 25
+
+func (t *solutionTracker) fork() *solutionTracker {
+	return &solutionTracker{
+		best:          t.best,
+		bestScore:     t.bestScore,
+		bestSolutions: slices.Clone(t.bestSolutions),
+		seen:          maps.Clone(t.seen),
+	}
+}
+
+func (t *solutionTracker) merge(o *solutionTracker) bool {
+	improved := false
+	for _, sol := range o.bestSolutions {
+		if t.add(sol, o.bestScore, o.best) {
+			improved = true
+		}
+	}
+	return improved
+}
+
+// solveParallel runs the random restarts and then the perturbation chains of
+// SolveFast on params.Workers goroutines, each with its own RNG seeded from
+// rng. Work is handed out in rounds: every worker chains its share of the
+// round on a fork of the tracker, and the forks are merged back in worker
+// order before the next round starts. Nothing depends on scheduling, so a
+// seed and worker count always give the same result unless a time budget
+// cuts the search short.
+func (s *solverState) solveParallel(params Params, rng *rand.Rand, tracker *solutionTracker, expired func() bool, report func(), improved func(iteration int)) {
+	workers := params.Workers
+	rngs := make([]*rand.Rand, workers)
+	for w := range rngs {
+		rngs[w] = rand.New(rand.NewSource(rng.Int63()))
+	}
+	buffers := make([][]int, workers)
+	for w := range buffers {
+		buffers[w] = make([]int, s.n)
+	}
+	forks := make([]*solutionTracker, workers)
+	var reportMu sync.Mutex
+	iterations := 0
+
+	round := func(count int, task func(w int, a []int, local *solutionTracker) bool) {
+		var wg sync.WaitGroup
+		for w := range workers {
+			forks[w] = tracker.fork()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a, local := buffers[w], forks[w]
+				for i := w; i < count; i += workers {
+					if expired() {
+						return
+					}
+					if task(w, a, local) {
+						score := s.fastHillClimb(a)
+						local.add(a, score, s.rating(a, score))
+					}
+					reportMu.Lock()
+					report()
+					iterations++
+					reportMu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		for _, local := range forks {
+			if tracker.merge(local) {
+				improved(iterations)
+			}
+		}
+	}
+
+	round(params.NumRandom, func(w int, a []int, local *solutionTracker) bool {
+		return s.randomPlacement(a, rngs[w])
+	})
+	for done := 0; (params.Budget > 0 || done < params.NumPerturb) && !expired(); done += workers * parallelRound {
+		count := workers * parallelRound
+		if params.Budget == 0 {
+			count = min(count, params.NumPerturb-done)
+		}
+		round(count, func(w int, a []int, local *solutionTracker) bool {
+			r := rngs[w]
+			src := local.bestSolutions[r.Intn(len(local.bestSolutions))]
+			s.perturb(a, src, params.PerturbMin+r.Intn(params.PerturbMax-params.PerturbMin), r)
+			return true
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestParallelSolveIsDeterministic(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	n := 24
+	p := Problem{N: n, RoomSizes: []int{4, 4, 4, 4, 4, 4}, PreferNotMultiple: 5, NoPreferCost: 10}
+	for i := range n {
+		for range 3 {
+			if j := rng.Intn(n); j != i {
+				p.Constraints = append(p.Constraints, Constraint{i, j, "prefer", 1 + rng.Intn(3)})
+			}
+		}
+	}
+	params := Params{NumRandom: 40, NumPerturb: 400, PerturbMin: 3, PerturbMax: 8, Workers: 4}
+	solve := func() Result {
+		res, err := Fast{Params: params, Rand: rand.New(rand.NewSource(42))}.Solve(context.Background(), p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	first, second := solve(), solve()
+	if !reflect.DeepEqual(first.Solutions, second.Solutions) {
+		t.Fatalf("same seed gave different solutions:\n%v\n%v", first.Solutions, second.Solutions)
+	}
+}
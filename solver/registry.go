@@ -0,0 +1,71 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Options carries what a strategy may need to build a Solver. Strategies
+// ignore the fields that do not apply to them.
+type Options struct {
+	Params Params
+	Rand   *rand.Rand
+}
+
+type Factory func(Options) Solver
+
+var registry = struct {
+	sync.Mutex
+	byName map[string]Factory
+}{byName: map[string]Factory{}}
+
+func Register(name string, f Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.byName[name]; ok {
+		panic("solver: strategy " + name + " registered twice")
+	}
+	registry.byName[name] = f
+}
+
+func Strategies() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	var names []string
+	for name := range registry.byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func New(name string, opts Options) (Solver, error) {
+	registry.Lock()
+	f, ok := registry.byName[name]
+	registry.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, must be one of %s", name, strings.Join(Strategies(), ", "))
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(42))
+	}
+	return f(opts), nil
+}
+
+func init() {
+	Register("fast", func(o Options) Solver { return Fast{Params: o.Params, Rand: o.Rand} })
+	Register("exact", func(o Options) Solver { return Exact{} })
+	Register("anneal", func(o Options) Solver {
+		a := DefaultAnneal
+		a.Rand = o.Rand
+		return a
+	})
+	Register("tabu", func(o Options) Solver {
+		t := DefaultTabu
+		t.Rand = o.Rand
+		return t
+	})
+}
@@ -0,0 +1,45 @@
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStrategiesReportStats(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	n := 16
+	p := Problem{N: n, RoomSizes: []int{4, 4, 4, 4}, PreferNotMultiple: 5, NoPreferCost: 10}
+	for i := range n {
+		for range 3 {
+			if j := rng.Intn(n); j != i {
+				p.Constraints = append(p.Constraints, Constraint{i, j, "prefer", 1 + rng.Intn(3)})
+			}
+		}
+	}
+	for _, name := range Strategies() {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(name, Options{Params: DefaultParams})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			var last Progress
+			start := time.Now()
+			res, err := s.Solve(ctx, p, func(pr Progress) { last = pr })
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := res.Stats
+			if st.Iterations == 0 || st.BestIteration > st.Iterations || st.BestFoundAfter > elapsed {
+				t.Errorf("stats %+v after %v", st, elapsed)
+			}
+			if last.Total > 0 && last.Iterations != st.Iterations {
+				t.Errorf("final progress reports %d iterations, stats %d", last.Iterations, st.Iterations)
+			}
+		})
+	}
+}
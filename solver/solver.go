@@ -1,16 +1,43 @@
 package solver
 
 import (
+	"context"
 	"math/rand"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Constraint struct {
 	StudentA int
 	StudentB int
 	Kind     string
+	Weight   int // prefer weight; zero counts as 1
+}
+
+const (
+	ObjectiveSum    = "sum"
+	ObjectiveMaxMin = "maxmin"
+	ObjectiveHybrid = "hybrid"
+)
+
+var Objectives = []string{ObjectiveSum, ObjectiveMaxMin, ObjectiveHybrid}
+
+type Problem struct {
+	N                 int
+	RoomSizes         []int
+	PreferNotMultiple int
+	NoPreferCost      int
+	Constraints       []Constraint
+	Pinned            map[int]int
+	Eligible          [][]bool
+	Objective         string
+	FairnessWeight    int
+	SingletonCost     int
+	MinOccupancy      int
+	UnderfillCost     int
+	ImbalanceCost     int
 }
 
 type Params struct {
@@ -18,6 +45,8 @@ type Params struct {
 	NumPerturb int
 	PerturbMin int
 	PerturbMax int
+	Workers    int
+	Budget     time.Duration // if set, perturb until it runs out instead of NumPerturb times
 }
 
 var DefaultParams = Params{
@@ -32,6 +61,18 @@ type Solution struct {
 	Score      int
 }
 
+type Progress struct {
+	Iterations int
+	Total      int
+	BestScore  int
+}
+
+type Stats struct {
+	Iterations     int
+	BestIteration  int
+	BestFoundAfter time.Duration
+}
+
 func normalizeKey(a []int) string {
 	rm := map[int][]int{}
 	for i, room := range a {
@@ -62,6 +103,9 @@ type solverState struct {
 	numRooms  int
 	pnMultiple int
 	npCost     int
+	objective  string
+	fairWeight int
+	fill       roomFill
 
 	constraints []Constraint
 	mustApart   map[[2]int]bool
@@ -71,21 +115,45 @@ type solverState struct {
 	groupOf     []int
 	uniqueGroups []int
 
+	pinned      map[int]int
+	groupPin    map[int]int
+	pinConflict bool
+	eligible    [][]bool
+	groupRooms  map[int][]bool
+
 	studentConstraints [][]int
 	hasPrefer          []bool
 	preferFrom         [][]int
 	mustApartFor       [][]int
 }
 
-func newSolverState(n int, roomSizes []int, pnMultiple, npCost int, constraints []Constraint) *solverState {
+func newSolverState(p Problem) *solverState {
+	n := p.N
+	constraints := slices.Clone(p.Constraints)
+	for i := range constraints {
+		if constraints[i].Weight < 1 {
+			constraints[i].Weight = 1
+		}
+	}
 	s := &solverState{
 		n:          n,
-		roomSizes:  roomSizes,
-		numRooms:   len(roomSizes),
-		pnMultiple: pnMultiple,
-		npCost:     npCost,
+		roomSizes:  p.RoomSizes,
+		numRooms:   len(p.RoomSizes),
+		pnMultiple: p.PreferNotMultiple,
+		npCost:     p.NoPreferCost,
+		objective:  p.Objective,
+		fairWeight: p.FairnessWeight,
+		fill:       p.roomFill(),
 		constraints: constraints,
 		mustApart:  map[[2]int]bool{},
+		pinned:     p.Pinned,
+		groupPin:   map[int]int{},
+		eligible:   p.Eligible,
+		groupRooms: map[int][]bool{},
+	}
+
+	if !slices.Contains(Objectives, s.objective) {
+		s.objective = ObjectiveSum
 	}
 
 	mustTogether := map[[2]int]bool{}
@@ -137,11 +205,61 @@ func newSolverState(n int, roomSizes []int, pnMultiple, npCost int, constraints
 		}
 	}
 
+	for student, room := range s.pinned {
+		root := s.groupOf[student]
+		if prev, ok := s.groupPin[root]; ok && prev != room {
+			s.pinConflict = true
+		}
+		if room < 0 || room >= s.numRooms {
+			s.pinConflict = true
+		}
+		s.groupPin[root] = room
+	}
+
+	for root, members := range s.groups {
+		pin, pinned := s.groupPin[root]
+		restricted := pinned
+		for _, m := range members {
+			if m < len(s.eligible) && s.eligible[m] != nil {
+				restricted = true
+			}
+		}
+		if !restricted {
+			continue
+		}
+		rooms := make([]bool, s.numRooms)
+		for room := range s.numRooms {
+			rooms[room] = !pinned || pin == room
+			for _, m := range members {
+				if m < len(s.eligible) && s.eligible[m] != nil && !s.eligible[m][room] {
+					rooms[room] = false
+				}
+			}
+		}
+		s.groupRooms[root] = rooms
+	}
+
 	s.groupList = make([][]int, 0, len(s.groups))
 	for _, members := range s.groups {
 		s.groupList = append(s.groupList, members)
 	}
+	allowedCount := func(members []int) int {
+		rooms := s.groupRooms[s.groupOf[members[0]]]
+		if rooms == nil {
+			return s.numRooms
+		}
+		c := 0
+		for _, ok := range rooms {
+			if ok {
+				c++
+			}
+		}
+		return c
+	}
 	slices.SortFunc(s.groupList, func(a, b []int) int {
+		if ca, cb := allowedCount(a), allowedCount(b); ca != cb {
+			return ca - cb
+		}
 		if len(b) != len(a) {
 			return len(b) - len(a)
 		}
@@ -178,6 +296,28 @@ func newSolverState(n int, roomSizes []int, pnMultiple, npCost int, constraints
 }
 
 func (s *solverState) hasHardConflict() bool {
+	if s.pinConflict {
+		return true
+	}
+	for _, rooms := range s.groupRooms {
+		if !slices.Contains(rooms, true) {
+			return true
+		}
+	}
+	for p := range s.mustApart {
+		ra, aPinned := s.groupPin[s.groupOf[p[0]]]
+		rb, bPinned := s.groupPin[s.groupOf[p[1]]]
+		if aPinned && bPinned && ra == rb {
+			return true
+		}
+	}
+	pinnedCount := make([]int, s.numRooms)
+	for root, room := range s.groupPin {
+		pinnedCount[room] += len(s.groups[root])
+		if pinnedCount[room] > s.roomSizes[room] {
+			return true
+		}
+	}
 	uf := make([]int, s.n)
 	for i := range uf {
 		uf[i] = i
@@ -213,7 +353,7 @@ func (s *solverState) score(assignment []int) int {
 		switch c.Kind {
 		case "prefer":
 			if sameRoom {
-				sc++
+				sc += c.Weight
 				gotPrefer[c.StudentA] = true
 			}
 		case "prefer_not":
@@ -227,252 +367,175 @@ func (s *solverState) score(assignment []int) int {
 			sc -= s.npCost
 		}
 	}
+	if s.fill.active() {
+		sc -= s.fill.total(s.roomSizes, assignment)
+	}
 	return sc
 }
 
-func (s *solverState) feasibleForGroup(assignment []int, groupRoot int, room int) bool {
-	for _, m := range s.groups[groupRoot] {
-		for _, partner := range s.mustApartFor[m] {
-			if s.groupOf[partner] != groupRoot && assignment[partner] == room {
-				return false
-			}
+func (s *solverState) studentScores(assignment []int) []int {
+	scores := make([]int, s.n)
+	gotPrefer := make([]bool, s.n)
+	for _, c := range s.constraints {
+		if assignment[c.StudentA] != assignment[c.StudentB] {
+			continue
+		}
+		switch c.Kind {
+		case "prefer":
+			scores[c.StudentA] += c.Weight
+			gotPrefer[c.StudentA] = true
+		case "prefer_not":
+			scores[c.StudentA] -= s.pnMultiple
 		}
 	}
-	return true
+	for i := range s.n {
+		if s.hasPrefer[i] && !gotPrefer[i] {
+			scores[i] -= s.npCost
+		}
+	}
+	return scores
 }
 
-func (s *solverState) fastHillClimb(assignment []int) int {
-	n := s.n
-	numRooms := s.numRooms
+// rating orders assignments under the trip's objective; larger compares
+// better with slices.Compare. For maxmin it is the ascending per-student
+// score vector, so comparing it is a lexicographic max-min, followed by the
+// total score to break ties.
+func (s *solverState) rating(assignment []int, score int) []int {
+	switch s.objective {
+	case ObjectiveMaxMin:
+		scores := s.studentScores(assignment)
+		slices.Sort(scores)
+		return append(scores, score)
+	case ObjectiveHybrid:
+		return []int{score + s.fairWeight*slices.Min(s.studentScores(assignment))}
+	}
+	return []int{score}
+}
 
-	roomCounts := make([]int, numRooms)
-	for _, room := range assignment {
-		roomCounts[room]++
-	}
+type studentDeltas struct {
+	delta   []int
+	touched []int
+}
 
-	prefSatCount := make([]int, n)
-	for _, c := range s.constraints {
-		if c.Kind == "prefer" && assignment[c.StudentA] == assignment[c.StudentB] {
-			prefSatCount[c.StudentA]++
-		}
-	}
+func newStudentDeltas(n int) *studentDeltas {
+	return &studentDeltas{delta: make([]int, n)}
+}
 
-	currentScore := 0
-	for _, c := range s.constraints {
-		if assignment[c.StudentA] == assignment[c.StudentB] {
-			switch c.Kind {
-			case "prefer":
-				currentScore++
-			case "prefer_not":
-				currentScore -= s.pnMultiple
-			}
-		}
+func (d *studentDeltas) add(student, v int) {
+	if v == 0 {
+		return
 	}
-	for i := range n {
-		if s.hasPrefer[i] && prefSatCount[i] == 0 {
-			currentScore -= s.npCost
-		}
+	if !slices.Contains(d.touched, student) {
+		d.touched = append(d.touched, student)
 	}
+	d.delta[student] += v
+}
 
-	memberSet := make([]bool, n)
-
-	deltaForMove := func(groupRoot int, oldRoom, newRoom int) int {
-		members := s.groups[groupRoot]
-		for _, m := range members {
-			memberSet[m] = true
-		}
+func (d *studentDeltas) reset() {
+	for _, st := range d.touched {
+		d.delta[st] = 0
+	}
+	d.touched = d.touched[:0]
+}
 
-		delta := 0
-		npAffected := make(map[int]int)
+type moveGain struct {
+	delta   int
+	value   int
+	removed []int
+	added   []int
+}
 
-		for _, m := range members {
-			for _, ci := range s.studentConstraints[m] {
-				c := s.constraints[ci]
-				other := c.StudentB
-				if other == m {
-					other = c.StudentA
-				}
-				if memberSet[other] {
-					continue
-				}
-				otherRoom := assignment[other]
-				wasSame := otherRoom == oldRoom
-				willBeSame := otherRoom == newRoom
-				if wasSame == willBeSame {
-					continue
-				}
-				switch c.Kind {
-				case "prefer":
-					if wasSame {
-						delta--
-						npAffected[c.StudentA]--
-					} else {
-						delta++
-						npAffected[c.StudentA]++
-					}
-				case "prefer_not":
-					if wasSame {
-						delta += s.pnMultiple
-					} else {
-						delta -= s.pnMultiple
-					}
-				}
+func (s *solverState) compareGain(a, b moveGain) int {
+	if s.objective != ObjectiveMaxMin {
+		return a.value - b.value
+	}
+	// Applying a yields V-a.removed+a.added; comparing that against b's
+	// result is the same as comparing a.added+b.removed with b.added+a.removed.
+	// The side holding the smallest unmatched score is the worse one.
+	x := slices.Concat(a.added, b.removed)
+	y := slices.Concat(b.added, a.removed)
+	slices.Sort(x)
+	slices.Sort(y)
+	for i := range x {
+		if x[i] != y[i] {
+			if x[i] < y[i] {
+				return -1
 			}
+			return 1
 		}
+	}
+	return a.delta - b.delta
+}
 
-		for student, change := range npAffected {
-			if !s.hasPrefer[student] {
-				continue
-			}
-			wasSat := prefSatCount[student] > 0
-			willBeSat := prefSatCount[student]+change > 0
-			if wasSat && !willBeSat {
-				delta -= s.npCost
-			} else if !wasSat && willBeSat {
-				delta += s.npCost
-			}
-		}
+func (s *solverState) allowed(groupRoot int, room int) bool {
+	rooms := s.groupRooms[groupRoot]
+	return rooms == nil || rooms[room]
+}
 
-		for _, m := range members {
-			memberSet[m] = false
-		}
-		return delta
+func (s *solverState) feasibleForGroup(assignment []int, groupRoot int, room int) bool {
+	if !s.allowed(groupRoot, room) {
+		return false
 	}
-
-	applyMove := func(groupRoot int, oldRoom, newRoom int) {
-		members := s.groups[groupRoot]
-		for _, m := range members {
-			memberSet[m] = true
-		}
-		for _, m := range members {
-			for _, ci := range s.studentConstraints[m] {
-				c := s.constraints[ci]
-				other := c.StudentB
-				if other == m {
-					other = c.StudentA
-				}
-				if memberSet[other] {
-					continue
-				}
-				otherRoom := assignment[other]
-				wasSame := otherRoom == oldRoom
-				willBeSame := otherRoom == newRoom
-				if wasSame == willBeSame {
-					continue
-				}
-				if c.Kind == "prefer" {
-					if wasSame {
-						prefSatCount[c.StudentA]--
-					} else {
-						prefSatCount[c.StudentA]++
-					}
-				}
+	for _, m := range s.groups[groupRoot] {
+		for _, partner := range s.mustApartFor[m] {
+			if s.groupOf[partner] != groupRoot && assignment[partner] == room {
+				return false
 			}
 		}
-		roomCounts[oldRoom] -= len(members)
-		for _, m := range members {
-			assignment[m] = newRoom
-		}
-		roomCounts[newRoom] += len(members)
-		for _, m := range members {
-			memberSet[m] = false
-		}
 	}
+	return true
+}
 
+func (s *solverState) fastHillClimb(assignment []int) int {
+	m := s.newMoveState(assignment)
 	for {
-		bestDelta := 0
-		bestGi := -1
-		bestTarget := -1
-		bestSwapGj := -1
-
-		for gi, gRoot := range s.uniqueGroups {
-			grp := s.groups[gRoot]
-			gRoom := assignment[grp[0]]
-
-			for room := range numRooms {
-				if room == gRoom {
-					continue
-				}
-				if roomCounts[room]+len(grp) > s.roomSizes[room] {
-					continue
-				}
-				if !s.feasibleForGroup(assignment, gRoot, room) {
-					continue
-				}
-				delta := deltaForMove(gRoot, gRoom, room)
-				if delta > bestDelta {
-					bestDelta = delta
-					bestGi = gi
-					bestTarget = room
-					bestSwapGj = -1
-				}
-			}
-
-			for gj := gi + 1; gj < len(s.uniqueGroups); gj++ {
-				g2Root := s.uniqueGroups[gj]
-				grp2 := s.groups[g2Root]
-				g2Room := assignment[grp2[0]]
-				if gRoom == g2Room {
-					continue
-				}
-				newGRoom := roomCounts[gRoom] - len(grp) + len(grp2)
-				newG2Room := roomCounts[g2Room] - len(grp2) + len(grp)
-				if newGRoom > s.roomSizes[gRoom] || newG2Room > s.roomSizes[g2Room] {
-					continue
-				}
-				if !s.feasibleForGroup(assignment, gRoot, g2Room) {
-					continue
-				}
-				delta1 := deltaForMove(gRoot, gRoom, g2Room)
-				applyMove(gRoot, gRoom, g2Room)
-				if !s.feasibleForGroup(assignment, g2Root, gRoom) {
-					applyMove(gRoot, g2Room, gRoom)
-					continue
-				}
-				delta2 := deltaForMove(g2Root, g2Room, gRoom)
-				applyMove(gRoot, g2Room, gRoom)
-
-				totalDelta := delta1 + delta2
-				if totalDelta > bestDelta {
-					bestDelta = totalDelta
-					bestGi = gi
-					bestTarget = -1
-					bestSwapGj = gj
-				}
+		var best moveGain
+		bestMove := move{group: -1}
+		m.neighbors(func(mv move, g moveGain) {
+			if s.compareGain(g, best) > 0 {
+				best, bestMove = g, mv
 			}
-		}
-
-		if bestDelta <= 0 {
+		})
+		if bestMove.group < 0 {
 			break
 		}
-
-		gRoot := s.uniqueGroups[bestGi]
-		gRoom := assignment[s.groups[gRoot][0]]
-		if bestSwapGj < 0 {
-			applyMove(gRoot, gRoom, bestTarget)
-		} else {
-			g2Root := s.uniqueGroups[bestSwapGj]
-			g2Room := assignment[s.groups[g2Root][0]]
-			applyMove(gRoot, gRoom, g2Room)
-			applyMove(g2Root, g2Room, gRoom)
-		}
-		currentScore += bestDelta
+		m.apply(bestMove, best)
 	}
-	return currentScore
+	return m.score
 }
 
+// placementLimit caps the backtracking in searchPlacement, so a packing
+// problem that is hard to settle gives up instead of running forever.
+const placementLimit = 1000000
+
 func (s *solverState) initialPlacement(assignment []int) bool {
+	found, _ := s.searchPlacement(assignment, placementLimit)
+	return found
+}
+
+// searchPlacement looks for any assignment that respects room capacities,
+// pins, eligibility and must_nots. complete is false when it gave up after
+// limit steps without settling whether one exists.
+func (s *solverState) searchPlacement(assignment []int, limit int) (found, complete bool) {
 	roomCap := make([]int, s.numRooms)
 	copy(roomCap, s.roomSizes)
+	class := s.roomClasses()
+	steps := 0
 
 	var placeGroups func(gi int) bool
 	placeGroups = func(gi int) bool {
 		if gi >= len(s.groupList) {
 			return true
 		}
+		if steps++; steps > limit {
+			return false
+		}
 		grp := s.groupList[gi]
 		for room := range s.numRooms {
-			if roomCap[room] < len(grp) {
+			if roomCap[room] < len(grp) || !s.allowed(s.groupOf[grp[0]], room) {
+				continue
+			}
+			if roomCap[room] == s.roomSizes[room] && s.emptyTwin(room, class, roomCap) {
 				continue
 			}
 			ok := true
@@ -510,7 +573,19 @@ func (s *solverState) initialPlacement(assignment []int) bool {
 		}
 		return false
 	}
-	return placeGroups(0)
+	found = placeGroups(0)
+	return found, found || steps <= limit
+}
+
+// emptyTwin reports whether an earlier room that no constraint can tell apart
+// from room is also still empty, in which case trying room as well is wasted.
+func (s *solverState) emptyTwin(room int, class, roomCap []int) bool {
+	for r := range room {
+		if class[r] == class[room] && roomCap[r] == s.roomSizes[r] {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *solverState) randomPlacement(assignment []int, rng *rand.Rand) bool {
@@ -522,7 +597,7 @@ func (s *solverState) randomPlacement(assignment []int, rng *rand.Rand) bool {
 		placed := false
 		order := rng.Perm(s.numRooms)
 		for _, room := range order {
-			if roomCap[room] < len(grp) {
+			if roomCap[room] < len(grp) || !s.allowed(s.groupOf[grp[0]], room) {
 				continue
 			}
 			valid := true
@@ -555,13 +630,15 @@ func (s *solverState) randomPlacement(assignment []int, rng *rand.Rand) bool {
 }
 
 type solutionTracker struct {
+	best          []int
 	bestScore     int
 	bestSolutions [][]int
 	seen          map[string]bool
 }
 
-func newTracker(initial []int, score int) *solutionTracker {
+func newTracker(initial []int, score int, rating []int) *solutionTracker {
 	t := &solutionTracker{
+		best:      rating,
 		bestScore: score,
 		seen:      map[string]bool{},
 	}
@@ -571,116 +648,140 @@ func newTracker(initial []int, score int) *solutionTracker {
 	return t
 }
 
-func (t *solutionTracker) add(a []int, s int) {
-	if s > t.bestScore {
+func (t *solutionTracker) add(a []int, s int, rating []int) bool {
+	c := slices.Compare(rating, t.best)
+	if c > 0 {
+		t.best = rating
 		t.bestScore = s
 		t.bestSolutions = nil
 		t.seen = map[string]bool{}
 	}
-	if s == t.bestScore {
+	if c >= 0 {
 		key := normalizeKey(a)
 		if !t.seen[key] {
 			t.seen[key] = true
 			t.bestSolutions = append(t.bestSolutions, slices.Clone(a))
 		}
 	}
+	return c > 0
 }
 
-func SolveFast(n int, roomSizes []int, pnMultiple, npCost int, constraints []Constraint, params Params, rng *rand.Rand) []Solution {
-	if n == 0 {
-		return nil
+func (t *solutionTracker) results(st *solverState) []Solution {
+	results := make([]Solution, len(t.bestSolutions))
+	for i, sol := range t.bestSolutions {
+		results[i] = Solution{Assignment: sol, Score: st.score(sol)}
 	}
+	return results
+}
 
-	st := newSolverState(n, roomSizes, pnMultiple, npCost, constraints)
-	if st.hasHardConflict() {
-		return nil
+func (s *solverState) perturb(assignment, src []int, count int, rng *rand.Rand) {
+	copy(assignment, src)
+	indices := rng.Perm(len(s.uniqueGroups))
+	count = min(count, len(indices))
+	for _, gi := range indices[:count] {
+		if _, ok := s.groupPin[s.uniqueGroups[gi]]; ok {
+			continue
+		}
+		grp := s.groups[s.uniqueGroups[gi]]
+		oldRoom := assignment[grp[0]]
+		rooms := rng.Perm(s.numRooms)
+		for _, room := range rooms {
+			if room == oldRoom {
+				continue
+			}
+			if roomCount(assignment, room)+len(grp) > s.roomSizes[room] {
+				continue
+			}
+			for _, m := range grp {
+				assignment[m] = room
+			}
+			if s.valid(assignment) {
+				break
+			}
+			for _, m := range grp {
+				assignment[m] = oldRoom
+			}
+		}
 	}
+}
 
-	assignment := make([]int, n)
-	if !st.initialPlacement(assignment) {
-		for i := range n {
-			assignment[i] = i % st.numRooms
+func roomCount(a []int, room int) int {
+	c := 0
+	for _, r := range a {
+		if r == room {
+			c++
 		}
 	}
+	return c
+}
 
-	initialAssignment := slices.Clone(assignment)
-	tracker := newTracker(assignment, st.score(assignment))
+func SolveFast(ctx context.Context, p Problem, params Params, rng *rand.Rand, progress func(Progress)) []Solution {
+	solutions, _, _ := solveFast(ctx, p, params, rng, progress)
+	return solutions
+}
 
-	roomCount := func(a []int, room int) int {
-		c := 0
-		for _, r := range a {
-			if r == room {
-				c++
-			}
-		}
-		return c
+func solveFast(ctx context.Context, p Problem, params Params, rng *rand.Rand, progress func(Progress)) ([]Solution, Stats, error) {
+	var stats Stats
+	st, assignment, tracker, err := startLocalSearch(p)
+	if err != nil {
+		return nil, stats, err
 	}
 
-	feasible := func(a []int) bool {
-		for p := range st.mustApart {
-			if a[p[0]] == a[p[1]] {
-				return false
-			}
-		}
-		rc := map[int]int{}
-		for _, room := range a {
-			rc[room]++
-		}
-		for room, cnt := range rc {
-			if cnt > st.roomSizes[room] {
-				return false
-			}
+	start := time.Now()
+	deadline := start.Add(params.Budget)
+	expired := func() bool {
+		return ctx.Err() != nil || (params.Budget > 0 && !time.Now().Before(deadline))
+	}
+
+	improved := func(iteration int) {
+		stats.BestIteration = iteration
+		stats.BestFoundAfter = time.Since(start)
+	}
+	climb := func() {
+		score := st.fastHillClimb(assignment)
+		if tracker.add(assignment, score, st.rating(assignment, score)) {
+			improved(stats.Iterations + 1)
 		}
-		return true
 	}
 
-	perturb := func(src []int, count int) {
-		copy(assignment, src)
-		indices := rng.Perm(len(st.uniqueGroups))
-		count = min(count, len(indices))
-		for _, gi := range indices[:count] {
-			grp := st.groups[st.uniqueGroups[gi]]
-			oldRoom := assignment[grp[0]]
-			rooms := rng.Perm(st.numRooms)
-			for _, room := range rooms {
-				if room == oldRoom {
-					continue
-				}
-				if roomCount(assignment, room)+len(grp) > st.roomSizes[room] {
-					continue
-				}
-				for _, m := range grp {
-					assignment[m] = room
-				}
-				if feasible(assignment) {
-					break
-				}
-				for _, m := range grp {
-					assignment[m] = oldRoom
-				}
-			}
+	score := st.fastHillClimb(assignment)
+	tracker.add(assignment, score, st.rating(assignment, score))
+
+	total := params.NumRandom + params.NumPerturb
+	if params.Budget > 0 {
+		total = 0
+	}
+	report := func() {
+		stats.Iterations++
+		if progress != nil {
+			progress(Progress{Iterations: stats.Iterations, Total: total, BestScore: tracker.bestScore})
 		}
 	}
 
-	copy(assignment, initialAssignment)
-	tracker.add(assignment, st.fastHillClimb(assignment))
+	if params.Workers > 1 {
+		st.solveParallel(params, rng, tracker, expired, report, improved)
+		return tracker.results(st), stats, nil
+	}
 
 	for range params.NumRandom {
+		if expired() {
+			break
+		}
 		if st.randomPlacement(assignment, rng) {
-			tracker.add(assignment, st.fastHillClimb(assignment))
+			climb()
 		}
+		report()
 	}
 
-	for range params.NumPerturb {
+	for i := 0; params.Budget > 0 || i < params.NumPerturb; i++ {
+		if expired() {
+			break
+		}
 		src := tracker.bestSolutions[rng.Intn(len(tracker.bestSolutions))]
-		perturb(src, params.PerturbMin+rng.Intn(params.PerturbMax-params.PerturbMin))
-		tracker.add(assignment, st.fastHillClimb(assignment))
+		st.perturb(assignment, src, params.PerturbMin+rng.Intn(params.PerturbMax-params.PerturbMin), rng)
+		climb()
+		report()
 	}
 
-	results := make([]Solution, len(tracker.bestSolutions))
-	for i, sol := range tracker.bestSolutions {
-		results[i] = Solution{Assignment: sol, Score: tracker.bestScore}
-	}
-	return results
+	return tracker.results(st), stats, nil
 }
-
@@ -0,0 +1,103 @@
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Tabu is tabu search over the same relocation and swap neighborhood as the
+// hill climb. Every iteration takes the best move that does not put a group
+// back into a room it left within the last Tenure iterations, even when that
+// move makes things worse, unless the move beats the best seen so far.
+type Tabu struct {
+	Restarts   int
+	Iterations int
+	Tenure     int
+	Rand       *rand.Rand
+}
+
+var DefaultTabu = Tabu{
+	Restarts:   5,
+	Iterations: 300,
+	Tenure:     10,
+}
+
+func (t Tabu) Solve(ctx context.Context, p Problem, progress func(Progress)) (Result, error) {
+	st, assignment, tracker, err := startLocalSearch(p)
+	if err != nil {
+		return Result{}, err
+	}
+	best := slices.Clone(assignment)
+	tabuUntil := make([]int, st.n*st.numRooms)
+	isTabu := func(group, room, iter int) bool {
+		return tabuUntil[group*st.numRooms+room] > iter
+	}
+	total := t.Restarts * t.Iterations
+	start := time.Now()
+	var stats Stats
+
+	for restart := range t.Restarts {
+		if ctx.Err() != nil {
+			break
+		}
+		if restart > 0 {
+			st.restart(assignment, tracker, t.Rand)
+		}
+		clear(tabuUntil)
+		m := st.newMoveState(assignment)
+		value, bestValue := 0, 0
+		bestIteration, bestAt := stats.Iterations, time.Now()
+		copy(best, assignment)
+		for iter := range t.Iterations {
+			if ctx.Err() != nil {
+				break
+			}
+			if progress != nil {
+				progress(Progress{Iterations: stats.Iterations, Total: total, BestScore: tracker.bestScore})
+			}
+			stats.Iterations++
+			var chosen moveGain
+			chosenMove := move{group: -1}
+			m.neighbors(func(mv move, g moveGain) {
+				tabu := false
+				if mv.swap < 0 {
+					tabu = isTabu(mv.group, mv.room, iter)
+				} else {
+					tabu = isTabu(mv.group, m.room(mv.swap), iter) || isTabu(mv.swap, m.room(mv.group), iter)
+				}
+				if tabu && value+g.value <= bestValue {
+					return
+				}
+				if chosenMove.group < 0 || st.compareGain(g, chosen) > 0 {
+					chosen, chosenMove = g, mv
+				}
+			})
+			if chosenMove.group < 0 {
+				break
+			}
+			tenure := t.Tenure + t.Rand.Intn(t.Tenure/2+1)
+			tabuUntil[chosenMove.group*st.numRooms+m.room(chosenMove.group)] = iter + tenure
+			if chosenMove.swap >= 0 {
+				tabuUntil[chosenMove.swap*st.numRooms+m.room(chosenMove.swap)] = iter + tenure
+			}
+			m.apply(chosenMove, chosen)
+			value += chosen.value
+			if value > bestValue {
+				bestValue = value
+				bestIteration, bestAt = stats.Iterations, time.Now()
+				copy(best, assignment)
+			}
+		}
+		copy(assignment, best)
+		score := st.fastHillClimb(assignment)
+		if tracker.add(assignment, score, st.rating(assignment, score)) {
+			stats.BestIteration, stats.BestFoundAfter = bestIteration, bestAt.Sub(start)
+		}
+	}
+	if progress != nil {
+		progress(Progress{Iterations: stats.Iterations, Total: total, BestScore: tracker.bestScore})
+	}
+	return Result{Solutions: tracker.results(st), Stats: stats}, nil
+}
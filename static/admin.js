@@ -1,4 +1,4 @@
-import { init, logout, api } from '/app.js';
+import { init, logout, logoutAll, api } from '/app.js';
 
 const profile = await init();
 
@@ -17,6 +17,7 @@ try {
 
 document.getElementById('main').style.display = 'block';
 document.getElementById('logout-btn').addEventListener('click', logout);
+document.getElementById('logout-all-btn').addEventListener('click', logoutAll);
 
 async function loadTrips() {
     const trips = await api('GET', '/api/trips');
@@ -93,6 +94,42 @@ async function loadTrips() {
         details.appendChild(input);
 
         card.appendChild(details);
+
+        const reuse = document.createElement('wa-details');
+        reuse.summary = 'Reuse';
+        const form = document.createElement('div');
+        form.className = 'add-form';
+        const cloneName = document.createElement('wa-input');
+        cloneName.placeholder = 'New trip name';
+        cloneName.size = 'small';
+        const withStudents = document.createElement('wa-checkbox');
+        withStudents.size = 'small';
+        withStudents.textContent = 'Include students';
+        const cloneBtn = document.createElement('wa-button');
+        cloneBtn.size = 'small';
+        cloneBtn.textContent = 'Clone Trip';
+        cloneBtn.addEventListener('click', async () => {
+            const name = (cloneName.value || '').trim();
+            if (!name) return;
+            await api('POST', '/api/trips/' + trip.id + '/clone', { name, students: withStudents.checked });
+            loadTrips();
+        });
+        const templateName = document.createElement('wa-input');
+        templateName.placeholder = 'Template name';
+        templateName.size = 'small';
+        const templateBtn = document.createElement('wa-button');
+        templateBtn.size = 'small';
+        templateBtn.textContent = 'Save as Template';
+        templateBtn.addEventListener('click', async () => {
+            const name = (templateName.value || '').trim();
+            if (!name) return;
+            await api('POST', '/api/admin/templates', { name, trip_id: trip.id });
+            templateName.value = '';
+            loadTemplates();
+        });
+        form.append(cloneName, withStudents, cloneBtn, templateName, templateBtn);
+        reuse.appendChild(form);
+        card.appendChild(reuse);
         container.appendChild(card);
     }
 }
@@ -101,14 +138,77 @@ async function createTrip() {
     const input = document.getElementById('new-trip-name');
     const name = input.value.trim();
     if (!name) return;
-    await api('POST', '/api/trips', { name });
+    const body = { name };
+    const templateID = parseInt(document.getElementById('new-trip-template').value);
+    if (templateID) body.template_id = templateID;
+    await api('POST', '/api/trips', body);
     input.value = '';
     loadTrips();
 }
 
+async function loadTemplates() {
+    const templates = await api('GET', '/api/admin/templates');
+    const container = document.getElementById('trip-templates');
+    const select = document.getElementById('new-trip-template');
+    container.innerHTML = '';
+    select.innerHTML = '';
+    for (const t of templates) {
+        const tag = document.createElement('wa-tag');
+        tag.size = 'small';
+        tag.setAttribute('with-remove', '');
+        tag.title = 'Saved by ' + t.created_by + ' on ' + new Date(t.created_at).toLocaleDateString();
+        tag.textContent = t.name;
+        tag.addEventListener('wa-remove', async () => {
+            if (!confirm('Delete template "' + t.name + '"?')) return;
+            await api('DELETE', '/api/admin/templates/' + t.id);
+            loadTemplates();
+        });
+        container.appendChild(tag);
+        const opt = document.createElement('wa-option');
+        opt.value = String(t.id);
+        opt.textContent = t.name;
+        select.appendChild(opt);
+    }
+}
+
 document.getElementById('create-trip-btn').addEventListener('click', createTrip);
 document.getElementById('new-trip-name').addEventListener('keydown', (e) => { if (e.key === 'Enter') createTrip(); });
 
+async function loadGlobalAdmins() {
+    const admins = await api('GET', '/api/admin/admins');
+    const container = document.getElementById('global-admins');
+    container.innerHTML = '';
+    for (const admin of admins) {
+        const tag = document.createElement('wa-tag');
+        tag.size = 'small';
+        tag.variant = 'brand';
+        tag.title = 'Granted by ' + admin.granted_by + ' on ' + new Date(admin.granted_at).toLocaleDateString();
+        if (admins.length > 1) tag.setAttribute('with-remove', '');
+        tag.textContent = admin.email;
+        tag.addEventListener('wa-remove', async () => {
+            if (admin.email === profile.email && !confirm('Remove your own super admin access?')) return;
+            await api('DELETE', '/api/admin/admins/' + admin.id);
+            if (admin.email === profile.email) location.reload();
+            loadGlobalAdmins();
+        });
+        container.appendChild(tag);
+    }
+}
+
+async function addGlobalAdmin() {
+    const input = document.getElementById('new-admin-email');
+    const email = (input.value || '').trim();
+    if (!email) return;
+    await api('POST', '/api/admin/admins', { email });
+    input.value = '';
+    loadGlobalAdmins();
+}
+
+document.getElementById('add-admin-btn').addEventListener('click', addGlobalAdmin);
+document.getElementById('new-admin-email').addEventListener('keydown', (e) => { if (e.key === 'Enter') addGlobalAdmin(); });
+
 await loadTrips();
+await loadTemplates();
+await loadGlobalAdmins();
 await customElements.whenDefined('wa-button');
 document.body.style.opacity = 1;
@@ -33,12 +33,26 @@ function setProfile(profile) {
     localStorage.setItem('profile', JSON.stringify(profile));
 }
 
+function endSession(path) {
+    const profile = getProfile();
+    const done = () => {
+        localStorage.removeItem('profile');
+        location.reload();
+    };
+    if (!profile?.token) return done();
+    fetch(path, { method: 'POST', headers: { 'Authorization': 'Bearer ' + profile.token } }).finally(done);
+}
+
 export function logout() {
-    localStorage.removeItem('profile');
-    location.reload();
+    endSession('/auth/logout');
 }
 
-export async function api(method, path, body) {
+export function logoutAll() {
+    if (!confirm('Sign out of all devices?')) return;
+    endSession('/auth/logout-all');
+}
+
+async function request(method, path, body) {
     const profile = getProfile();
     const opts = {
         method,
@@ -53,13 +67,27 @@ export async function api(method, path, body) {
         opts.body = JSON.stringify(body);
     }
     const res = await fetch(path, opts);
+    if (res.status === 401 && profile) {
+        localStorage.removeItem('profile');
+        location.reload();
+    }
     if (!res.ok) {
         throw new Error(await res.text());
     }
+    return res;
+}
+
+export async function api(method, path, body) {
+    const res = await request(method, path, body);
     if (res.status === 204) return null;
     return res.json();
 }
 
+export async function apiBlob(method, path, body) {
+    const res = await request(method, path, body);
+    return res.blob();
+}
+
 function bind(data) {
     document.querySelectorAll('[data-bind]').forEach(el => {
         const key = el.dataset.bind;
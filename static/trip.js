@@ -1,10 +1,18 @@
-import { init, logout, api } from '/app.js';
+import { init, logout, logoutAll, api, apiBlob } from '/app.js';
 
 const DOMAIN = '{{.env.DOMAIN}}';
 const tripID = location.pathname.split('/').pop();
 
 const profile = await init();
 
+const toLocalInput = (iso) => {
+    if (!iso) return '';
+    const d = new Date(iso);
+    return new Date(d.getTime() - d.getTimezoneOffset() * 60000).toISOString().slice(0, 16);
+};
+const fromLocalInput = (value) => value ? new Date(value).toISOString() : '';
+const ordinal = (n) => n + ({ 1: 'st', 2: 'nd', 3: 'rd' }[n] || 'th');
+
 let trip, me;
 try {
     [trip, me] = await Promise.all([
@@ -20,6 +28,7 @@ try {
 document.getElementById('trip-name').textContent = trip.name;
 document.getElementById('main').style.display = 'block';
 document.getElementById('logout-btn').addEventListener('click', logout);
+document.getElementById('logout-all-btn').addEventListener('click', logoutAll);
 
 if (me.role !== 'admin') {
     document.getElementById('member-view').style.display = 'block';
@@ -32,11 +41,29 @@ await (async () => {
 document.getElementById('admin-view').style.display = 'block';
 document.getElementById('pn-multiple').value = trip.prefer_not_multiple;
 document.getElementById('np-cost').value = trip.no_prefer_cost;
+document.getElementById('rank-weights').value = trip.rank_weights.join(', ');
+document.getElementById('objective').value = trip.objective;
+document.getElementById('fairness-weight').value = trip.fairness_weight;
+for (const field of ['singleton_cost', 'min_occupancy', 'underfill_cost', 'imbalance_cost']) {
+    const input = document.getElementById(field.replaceAll('_', '-'));
+    input.value = trip[field];
+    input.addEventListener('change', async () => {
+        const val = parseInt(input.value);
+        if (val >= 0) await api('PATCH', '/api/trips/' + tripID, { [field]: val });
+    });
+}
+document.getElementById('fairness-weight-label').style.display = trip.objective === 'hybrid' ? '' : 'none';
 
 let roomGroups = [];
+let rooms = [];
+
+const roomLabel = (room) => room.name || 'Room ' + room.room;
 
 async function loadRoomGroups() {
-    roomGroups = await api('GET', '/api/trips/' + tripID + '/room-groups');
+    [roomGroups, rooms] = await Promise.all([
+        api('GET', '/api/trips/' + tripID + '/room-groups'),
+        api('GET', '/api/trips/' + tripID + '/rooms')
+    ]);
     const tags = document.getElementById('room-group-tags');
     tags.innerHTML = '';
     for (const rg of roomGroups) {
@@ -46,23 +73,114 @@ async function loadRoomGroups() {
         tag.textContent = rg.count + ' \u00d7 ' + rg.size + '-person';
         tag.addEventListener('wa-remove', async () => {
             await api('DELETE', '/api/trips/' + tripID + '/room-groups/' + rg.id);
-            loadRoomGroups();
+            await loadRoomGroups();
+            loadStudents();
+        });
+        tags.appendChild(tag);
+    }
+
+    const list = document.getElementById('room-list');
+    list.innerHTML = '';
+    for (const room of rooms) {
+        const row = document.createElement('div');
+        row.className = 'room-row';
+        const num = document.createElement('span');
+        num.textContent = room.room + '.';
+        row.appendChild(num);
+        for (const [field, placeholder] of [['name', 'Name'], ['building', 'Building'], ['floor', 'Floor'], ['capacity', 'Beds']]) {
+            const input = document.createElement('input');
+            input.placeholder = placeholder;
+            input.value = room[field];
+            if (field === 'capacity') {
+                input.type = 'number';
+                input.min = 1;
+            }
+            input.addEventListener('change', async () => {
+                const value = field === 'capacity' ? parseInt(input.value) : input.value.trim();
+                if (field === 'capacity' && !(value >= 1)) return;
+                await api('PATCH', '/api/trips/' + tripID + '/rooms/' + room.id, { [field]: value });
+                await loadRoomGroups();
+                loadStudents();
+            });
+            row.appendChild(input);
+        }
+        list.appendChild(row);
+    }
+
+    const target = document.getElementById('new-rule-target');
+    target.innerHTML = '';
+    for (const rg of roomGroups) {
+        const opt = document.createElement('option');
+        opt.value = 'group:' + rg.id;
+        opt.textContent = rg.count + ' \u00d7 ' + rg.size + '-person';
+        target.appendChild(opt);
+    }
+    for (const room of rooms) {
+        const opt = document.createElement('option');
+        opt.value = 'room:' + room.id;
+        opt.textContent = roomLabel(room);
+        target.appendChild(opt);
+    }
+    await loadRoomRules();
+}
+
+async function loadRoomRules() {
+    const rules = await api('GET', '/api/trips/' + tripID + '/room-rules');
+    const tags = document.getElementById('room-rule-tags');
+    tags.innerHTML = '';
+    for (const rule of rules) {
+        let targetName;
+        if (rule.room_id) {
+            const room = rooms.find(r => r.id === rule.room_id);
+            targetName = room ? roomLabel(room) : 'Room';
+        } else {
+            const rg = roomGroups.find(g => g.id === rule.room_group_id);
+            targetName = rg ? rg.count + ' \u00d7 ' + rg.size + '-person' : 'Group';
+        }
+        const tag = document.createElement('wa-tag');
+        tag.size = 'small';
+        tag.setAttribute('with-remove', '');
+        tag.textContent = targetName + ': ' + rule.key + ' = ' + rule.value;
+        tag.addEventListener('wa-remove', async () => {
+            await api('DELETE', '/api/trips/' + tripID + '/room-rules/' + rule.id);
+            loadRoomRules();
         });
         tags.appendChild(tag);
     }
 }
 await loadRoomGroups();
 
+document.getElementById('add-rule-btn').addEventListener('click', async () => {
+    const target = document.getElementById('new-rule-target').value;
+    const keyInput = document.getElementById('new-rule-key');
+    const valueInput = document.getElementById('new-rule-value');
+    const key = (keyInput.value || '').trim();
+    const value = (valueInput.value || '').trim();
+    if (!target || !key || !value) return;
+    const [kind, id] = target.split(':');
+    const body = { key, value };
+    body[kind === 'group' ? 'room_group_id' : 'room_id'] = parseInt(id);
+    await api('POST', '/api/trips/' + tripID + '/room-rules', body);
+    valueInput.value = '';
+    loadRoomRules();
+});
+
 document.getElementById('add-rg-btn').addEventListener('click', async () => {
     const sizeInput = document.getElementById('new-rg-size');
     const countInput = document.getElementById('new-rg-count');
+    const buildingInput = document.getElementById('new-rg-building');
+    const floorInput = document.getElementById('new-rg-floor');
+    const startInput = document.getElementById('new-rg-start');
     const size = parseInt((sizeInput.value || '').trim());
     const count = parseInt((countInput.value || '').trim());
     if (!size || size < 1 || !count || count < 1) return;
-    await api('POST', '/api/trips/' + tripID + '/room-groups', { size, count });
-    sizeInput.value = '';
-    countInput.value = '';
-    loadRoomGroups();
+    const body = { size, count, building: (buildingInput.value || '').trim(), floor: (floorInput.value || '').trim() };
+    const start = parseInt((startInput.value || '').trim());
+    if (!isNaN(start)) body.start_number = start;
+    await api('POST', '/api/trips/' + tripID + '/room-groups', body);
+    for (const input of [sizeInput, countInput, buildingInput, floorInput, startInput]) input.value = '';
+    await loadRoomGroups();
+    loadStudents();
 });
 
 document.getElementById('pn-multiple').addEventListener('change', async () => {
@@ -73,20 +191,114 @@ document.getElementById('np-cost').addEventListener('change', async () => {
     const val = parseInt(document.getElementById('np-cost').value);
     if (val >= 0) await api('PATCH', '/api/trips/' + tripID, { no_prefer_cost: val });
 });
+document.getElementById('objective').addEventListener('change', async (e) => {
+    await api('PATCH', '/api/trips/' + tripID, { objective: e.target.value });
+    document.getElementById('fairness-weight-label').style.display = e.target.value === 'hybrid' ? '' : 'none';
+});
+document.getElementById('fairness-weight').addEventListener('change', async () => {
+    const val = parseInt(document.getElementById('fairness-weight').value);
+    if (val >= 0) await api('PATCH', '/api/trips/' + tripID, { fairness_weight: val });
+});
+document.getElementById('rank-weights').addEventListener('change', async () => {
+    const input = document.getElementById('rank-weights');
+    const weights = input.value.split(',').map(v => parseInt(v.trim()));
+    if (weights.length === 0 || weights.some(v => !(v >= 1))) {
+        input.value = trip.rank_weights.join(', ');
+        return;
+    }
+    await api('PATCH', '/api/trips/' + tripID, { rank_weights: weights });
+    trip.rank_weights = weights;
+    loadStudents();
+});
+
+for (const field of ['student_opens_at', 'student_closes_at', 'parent_opens_at', 'parent_closes_at']) {
+    const input = document.getElementById(field.replaceAll('_', '-'));
+    input.value = toLocalInput(trip[field]);
+    input.addEventListener('change', async () => {
+        await api('PATCH', '/api/trips/' + tripID, { [field]: fromLocalInput(input.value) });
+    });
+}
+
+async function loadExtensions() {
+    const extensions = await api('GET', '/api/trips/' + tripID + '/extensions');
+    const tags = document.getElementById('extension-tags');
+    tags.innerHTML = '';
+    for (const ext of extensions) {
+        const tag = document.createElement('wa-tag');
+        tag.size = 'small';
+        tag.setAttribute('with-remove', '');
+        tag.textContent = ext.student_name + ' (' + ext.level + ') until ' + new Date(ext.closes_at).toLocaleString();
+        tag.addEventListener('wa-remove', async () => {
+            await api('DELETE', '/api/trips/' + tripID + '/extensions/' + ext.id);
+            loadExtensions();
+        });
+        tags.appendChild(tag);
+    }
+}
+await loadExtensions();
+
+document.getElementById('add-extension-btn').addEventListener('click', async () => {
+    const studentID = parseInt(document.getElementById('extension-student').value);
+    const level = document.getElementById('extension-level').value;
+    const closesAt = fromLocalInput(document.getElementById('extension-closes').value);
+    if (!studentID || !closesAt) return;
+    await api('PUT', '/api/trips/' + tripID + '/extensions', { student_id: studentID, level, closes_at: closesAt });
+    loadExtensions();
+});
+
+async function loadNotifications() {
+    const notifications = await api('GET', '/api/trips/' + tripID + '/notifications');
+    const sent = notifications.filter(n => n.sent_at).length;
+    const failed = notifications.filter(n => !n.sent_at && n.last_error).length;
+    const pending = notifications.length - sent - failed;
+    const parts = [];
+    if (sent) parts.push(sent + ' sent');
+    if (pending) parts.push(pending + ' pending');
+    if (failed) parts.push(failed + ' retrying');
+    document.getElementById('notification-status').textContent = parts.length ? 'Emails: ' + parts.join(', ') : '';
+}
+await loadNotifications();
+
+document.getElementById('send-invites-btn').addEventListener('click', async () => {
+    const level = document.getElementById('invite-level').value;
+    const { queued } = await api('POST', '/api/trips/' + tripID + '/notifications/invite', { level });
+    await loadNotifications();
+    const status = document.getElementById('notification-status');
+    status.textContent = queued + ' invite' + (queued === 1 ? '' : 's') + ' queued' + (status.textContent ? '; ' + status.textContent : '');
+});
 
 let lastOveralls = {};
+let studentNames = {};
+let pinnedRooms = {};
 
 async function loadStudents() {
-    const [students, constraintData] = await Promise.all([
+    const [students, constraintData, pins] = await Promise.all([
         api('GET', '/api/trips/' + tripID + '/students'),
-        api('GET', '/api/trips/' + tripID + '/constraints')
+        api('GET', '/api/trips/' + tripID + '/constraints'),
+        api('GET', '/api/trips/' + tripID + '/pins')
     ]);
+    pinnedRooms = {};
+    for (const p of pins) pinnedRooms[p.student_id] = p.room_id;
+    studentNames = {};
+    for (const select of [document.getElementById('history-student'), document.getElementById('extension-student')]) {
+        const selected = select.value;
+        select.length = 1;
+        for (const s of students) {
+            const opt = document.createElement('option');
+            opt.value = s.id;
+            opt.textContent = s.name;
+            select.appendChild(opt);
+        }
+        select.value = selected;
+    }
+    for (const s of students) studentNames[s.id] = s.name;
     const constraints = constraintData.constraints;
     const conflictList = constraintData.overrides;
     const kindLabels = { must: 'Must', prefer: 'Prefer', prefer_not: 'Prefer Not', must_not: 'Must Not' };
     const kindVariant = { must: 'success', prefer: 'brand', prefer_not: 'warning', must_not: 'danger' };
     const kindColor = { must: 'var(--wa-color-success-50)', prefer: 'var(--wa-color-brand-50)', prefer_not: 'var(--wa-color-warning-50)', must_not: 'var(--wa-color-danger-50)' };
     const kindOrder = { must: 0, prefer: 1, prefer_not: 2, must_not: 3 };
+    const kindText = (c) => kindLabels[c.kind] + (c.rank ? ' (' + ordinal(c.rank) + ')' : '');
     const capitalize = s => s.charAt(0).toUpperCase() + s.slice(1);
 
     const conflictMap = {};
@@ -186,7 +398,7 @@ async function loadStudents() {
             const div = document.createElement('div');
             div.className = 'conflict-row';
             div.appendChild(kindSpan('must'));
-            const maxSize = roomGroups.length > 0 ? Math.max(...roomGroups.map(g => g.size)) : 0;
+            const maxSize = rooms.length > 0 ? Math.max(...rooms.map(r => r.capacity)) : 0;
             div.appendChild(document.createTextNode(' group too large (' + members.length + ' for max room size ' + maxSize + '): ' + members.join(', ')));
             det.appendChild(div);
         }
@@ -213,6 +425,31 @@ async function loadStudents() {
         label.className = 'student-name';
         label.style.flex = '1';
         label.textContent = student.name + ' (' + student.email + ')';
+        const pinLabel = document.createElement('label');
+        pinLabel.className = 'pin-label';
+        pinLabel.textContent = '\u{1f4cc}';
+        const pinInput = document.createElement('select');
+        const noPin = document.createElement('option');
+        noPin.value = '';
+        noPin.textContent = 'Any room';
+        pinInput.appendChild(noPin);
+        for (const room of rooms) {
+            const opt = document.createElement('option');
+            opt.value = room.id;
+            opt.textContent = roomLabel(room);
+            pinInput.appendChild(opt);
+        }
+        pinInput.value = pinnedRooms[student.id] || '';
+        pinInput.addEventListener('change', async () => {
+            const roomID = parseInt(pinInput.value);
+            if (roomID) {
+                await api('POST', '/api/trips/' + tripID + '/pins', { room_id: roomID, student_ids: [student.id] });
+            } else if (pinnedRooms[student.id]) {
+                await api('DELETE', '/api/trips/' + tripID + '/pins/' + student.id);
+            }
+            loadStudents();
+        });
+        pinLabel.appendChild(pinInput);
         const deleteBtn = document.createElement('button');
         deleteBtn.className = 'close-btn';
         deleteBtn.textContent = '\u00d7';
@@ -222,6 +459,7 @@ async function loadStudents() {
             loadStudents();
         });
         nameRow.appendChild(label);
+        nameRow.appendChild(pinLabel);
         nameRow.appendChild(deleteBtn);
         card.appendChild(nameRow);
 
@@ -273,6 +511,45 @@ async function loadStudents() {
 
         card.appendChild(details);
 
+        const aDetails = document.createElement('wa-details');
+        aDetails.summary = 'Attributes';
+        const aTags = document.createElement('div');
+        aTags.className = 'tags';
+        for (const [key, value] of Object.entries(student.attributes)) {
+            const tag = document.createElement('wa-tag');
+            tag.size = 'small';
+            tag.variant = 'neutral';
+            tag.setAttribute('with-remove', '');
+            tag.textContent = key + ': ' + value;
+            tag.addEventListener('wa-remove', async () => {
+                await api('DELETE', '/api/trips/' + tripID + '/students/' + student.id + '/attributes/' + encodeURIComponent(key));
+                loadStudents();
+            });
+            aTags.appendChild(tag);
+        }
+        aDetails.appendChild(aTags);
+        const aInput = document.createElement('wa-input');
+        aInput.placeholder = 'key=value, e.g. gender=F';
+        aInput.size = 'small';
+        aInput.className = 'email';
+        aInput.style.marginTop = '0.3rem';
+        const aAddBtn = document.createElement('button');
+        aAddBtn.slot = 'end';
+        aAddBtn.className = 'input-action';
+        aAddBtn.textContent = '+';
+        const doAddAttr = async () => {
+            const [key, ...rest] = (aInput.value || '').split('=');
+            const value = rest.join('=').trim();
+            if (!key.trim() || !value) return;
+            await api('PUT', '/api/trips/' + tripID + '/students/' + student.id + '/attributes/' + encodeURIComponent(key.trim()), { value });
+            loadStudents();
+        };
+        aAddBtn.addEventListener('click', doAddAttr);
+        aInput.addEventListener('keydown', (e) => { if (e.key === 'Enter') doAddAttr(); });
+        aInput.appendChild(aAddBtn);
+        aDetails.appendChild(aInput);
+        card.appendChild(aDetails);
+
         const cDetails = document.createElement('wa-details');
         cDetails.summary = 'Constraints';
 
@@ -295,8 +572,8 @@ async function loadStudents() {
                 const tag = document.createElement('wa-tag');
                 tag.size = 'small';
                 tag.variant = kindVariant[c.kind];
-                tag.textContent = kindLabels[c.kind] + ': ' + c.student_b_name;
-                tag.title = 'From ' + capitalize(c.level);
+                tag.textContent = kindText(c) + ': ' + c.student_b_name;
+                tag.title = 'From ' + capitalize(c.level) + (c.kind === 'prefer' ? ', weight ' + c.weight : '');
                 group.appendChild(tag);
             }
             cDetails.appendChild(group);
@@ -331,10 +608,10 @@ async function loadStudents() {
                     icon.className = 'conflict-icon';
                     icon.textContent = '\u26a0 ';
                     tag.appendChild(icon);
-                    tag.appendChild(document.createTextNode(kindLabels[c.kind] + ': ' + otherName));
+                    tag.appendChild(document.createTextNode(kindText(c) + ': ' + otherName));
                     tag.title = 'Overrides: ' + conflictMap[c.id];
                 } else {
-                    tag.textContent = kindLabels[c.kind] + ': ' + otherName;
+                    tag.textContent = kindText(c) + ': ' + otherName;
                 }
                 group.appendChild(tag);
             }
@@ -443,188 +720,487 @@ async function addStudent() {
     loadStudents();
 }
 
-document.getElementById('add-student-btn').addEventListener('click', addStudent);
-document.getElementById('solve-btn').addEventListener('click', async () => {
-    const btn = document.getElementById('solve-btn');
-    btn.loading = true;
+async function loadHistory() {
+    const studentID = document.getElementById('history-student').value;
+    const entries = await api('GET', '/api/trips/' + tripID + '/audit' + (studentID ? '?student_id=' + studentID : ''));
+    const list = document.getElementById('history-list');
+    list.innerHTML = '';
+    for (const e of entries) {
+        const row = document.createElement('div');
+        row.className = 'history-row';
+        const time = document.createElement('span');
+        time.className = 'history-time';
+        time.textContent = new Date(e.created_at).toLocaleString();
+        row.appendChild(time);
+        const detail = e.after || e.before || {};
+        let text = e.actor + ' (' + e.role + ') ' + e.action.replace('.', ' ');
+        const names = e.student_ids.map(id => studentNames[id] || detail.name || '#' + id);
+        if (names.length > 0) text += ': ' + names.join(' \u2192 ');
+        if (detail.kind) text += ' [' + detail.level + ' ' + detail.kind.replace('_', ' ') + ']';
+        row.appendChild(document.createTextNode(text));
+        row.title = JSON.stringify({ before: e.before, after: e.after }, null, 1);
+        list.appendChild(row);
+    }
+    if (entries.length === 0) list.textContent = 'No changes recorded.';
+}
+
+document.getElementById('history').addEventListener('wa-show', loadHistory);
+document.getElementById('history-student').addEventListener('change', loadHistory);
+
+async function importRoster(commit) {
+    const file = document.getElementById('import-file').files[0];
+    const preview = document.getElementById('import-preview');
+    const importBtn = document.getElementById('import-commit-btn');
+    if (!file) return;
+    const body = { commit };
+    if (file.name.toLowerCase().endsWith('.xlsx')) {
+        const url = await new Promise((resolve, reject) => {
+            const reader = new FileReader();
+            reader.onload = () => resolve(reader.result);
+            reader.onerror = () => reject(reader.error);
+            reader.readAsDataURL(file);
+        });
+        body.format = 'xlsx';
+        body.data = url.slice(url.indexOf(',') + 1);
+    } else {
+        body.format = 'csv';
+        body.data = await file.text();
+    }
+    preview.innerHTML = '';
+    importBtn.disabled = true;
+    let result;
     try {
-        const result = await api('POST', '/api/trips/' + tripID + '/solve');
-        const container = document.getElementById('solver-results');
-        container.innerHTML = '';
+        result = await api('POST', '/api/trips/' + tripID + '/students/import', body);
+    } catch (e) {
+        preview.textContent = e.message;
+        return;
+    }
+    if (result.committed) {
+        preview.textContent = 'Imported ' + result.rows.length + ' students.';
+        document.getElementById('import-file').value = '';
+        loadStudents();
+        return;
+    }
+    for (const row of result.rows) {
+        const div = document.createElement('div');
+        div.className = 'conflict-row';
+        let text = row.line + '. ' + row.name + ' <' + row.email + '>';
+        if (row.parents.length > 0) text += ' \u2014 parents: ' + row.parents.join(', ');
+        if (row.errors.length > 0) {
+            const icon = document.createElement('span');
+            icon.className = 'conflict-icon';
+            icon.textContent = '!';
+            div.appendChild(icon);
+            text += ' \u2014 ' + row.errors.join('; ');
+        }
+        div.appendChild(document.createTextNode(text));
+        preview.appendChild(div);
+    }
+    importBtn.disabled = !result.valid;
+}
 
-        const renderRoomCard = (room, parent, roomNum, locked) => {
-            const card = document.createElement('wa-card');
-            card.className = 'room-card' + (locked ? ' room-locked' : '');
-            if (locked) card.setAttribute('appearance', 'outlined');
-            const label = document.createElement('div');
-            label.className = 'room-label';
-            label.textContent = 'Room ' + roomNum;
-            card.appendChild(label);
-            const tags = document.createElement('div');
-            tags.className = 'tags';
-            const roomIDs = room.map(m => m.id);
-            const violations = [];
-            for (const a of room) {
-                for (const b of room) {
-                    if (a.id === b.id) continue;
-                    const eff = lastOveralls[a.id]?.[b.id];
-                    if (eff && eff.kind === 'prefer_not') {
-                        violations.push({ from: a.name, to: b.name });
-                    }
-                }
-            }
-            for (const member of room) {
-                const tag = document.createElement('wa-tag');
-                tag.size = 'small';
-                tag.style.cursor = 'pointer';
-                const hasViolation = violations.some(v => v.from === member.name || v.to === member.name);
-                const hasPrefers = Object.values(lastOveralls[member.id] || {}).some(e => e.kind === 'prefer');
-                const gotPrefer = hasPrefers && roomIDs.some(rid => rid !== member.id && lastOveralls[member.id]?.[rid]?.kind === 'prefer');
-                if (hasViolation) tag.variant = 'danger';
-                else if (hasPrefers && !gotPrefer) tag.variant = 'warning';
-                else tag.variant = 'brand';
-                tag.textContent = member.name;
-                tag.addEventListener('click', () => {
-                    const studentCard = document.querySelector('[data-student-id="' + member.id + '"]');
-                    if (!studentCard) return;
-                    const cDet = [...studentCard.querySelectorAll('wa-details')].find(d => d.summary === 'Constraints');
-                    if (cDet) cDet.open = true;
-                    studentCard.scrollIntoView({ behavior: 'smooth', block: 'center' });
-                });
-                tags.appendChild(tag);
-            }
-            if (violations.length > 0) {
-                const warn = document.createElement('div');
-                warn.style.fontSize = '0.75rem';
-                warn.style.color = 'var(--wa-color-warning-50)';
-                warn.textContent = violations.map(v => v.from + ' \u2192 ' + v.to).join(', ');
-                card.appendChild(tags);
-                card.appendChild(warn);
-            } else {
-                card.appendChild(tags);
+document.getElementById('import-preview-btn').addEventListener('click', () => importRoster(false));
+document.getElementById('import-commit-btn').addEventListener('click', () => importRoster(true));
+
+const explainMember = (ex) => {
+    const names = (list) => list.map(m => m.name).join(', ');
+    const lines = ['Score: ' + ex.score];
+    if (ex.prefers_satisfied.length) lines.push('With preferred: ' + names(ex.prefers_satisfied));
+    if (ex.prefers_unsatisfied.length) lines.push('Missed preferred: ' + names(ex.prefers_unsatisfied));
+    if (ex.prefer_nots_violated.length) lines.push('With prefer-not: ' + names(ex.prefer_nots_violated));
+    if (ex.no_prefer_penalty) lines.push('No preferences satisfied');
+    return lines.join('\n');
+};
+
+const renderRoomCard = (room, parent, locked) => {
+    const members = room.members;
+    const card = document.createElement('wa-card');
+    card.className = 'room-card' + (locked ? ' room-locked' : '');
+    if (locked) card.setAttribute('appearance', 'outlined');
+    const label = document.createElement('div');
+    label.className = 'room-label';
+    label.textContent = roomLabel(room);
+    const place = [room.building, room.floor && 'Floor ' + room.floor].filter(Boolean).join(', ');
+    if (place) {
+        const loc = document.createElement('span');
+        loc.className = 'room-location';
+        loc.textContent = ' ' + place;
+        label.appendChild(loc);
+    }
+    if (room.score !== undefined) {
+        const score = document.createElement('span');
+        score.className = 'room-location';
+        score.textContent = ' (' + (room.score > 0 ? '+' : '') + room.score + ')';
+        if (room.fill_penalty) score.title = 'Includes \u2212' + room.fill_penalty + ' for how full the room is';
+        label.appendChild(score);
+    }
+    if (room.id) {
+        const pinBtn = document.createElement('button');
+        pinBtn.className = 'input-action';
+        pinBtn.textContent = '\u{1f4cc}';
+        pinBtn.title = 'Pin these students to ' + roomLabel(room);
+        pinBtn.addEventListener('click', async () => {
+            if (!confirm('Pin ' + members.map(m => m.name).join(', ') + ' to ' + roomLabel(room) + '?')) return;
+            await api('POST', '/api/trips/' + tripID + '/pins', { room_id: room.id, student_ids: members.map(m => m.id) });
+            await loadStudents();
+        });
+        label.appendChild(pinBtn);
+    }
+    card.appendChild(label);
+    const tags = document.createElement('div');
+    tags.className = 'tags';
+    const roomIDs = members.map(m => m.id);
+    const violations = [];
+    for (const a of members) {
+        for (const b of members) {
+            if (a.id === b.id) continue;
+            const eff = lastOveralls[a.id]?.[b.id];
+            if (eff && eff.kind === 'prefer_not') {
+                violations.push({ from: a.name, to: b.name });
             }
-            parent.appendChild(card);
-        };
+        }
+    }
+    for (const member of members) {
+        const tag = document.createElement('wa-tag');
+        tag.size = 'small';
+        tag.style.cursor = 'pointer';
+        const hasViolation = violations.some(v => v.from === member.name || v.to === member.name);
+        const hasPrefers = Object.values(lastOveralls[member.id] || {}).some(e => e.kind === 'prefer');
+        const gotPrefer = hasPrefers && roomIDs.some(rid => rid !== member.id && lastOveralls[member.id]?.[rid]?.kind === 'prefer');
+        if (hasViolation) tag.variant = 'danger';
+        else if (hasPrefers && !gotPrefer) tag.variant = 'warning';
+        else tag.variant = 'brand';
+        tag.textContent = (pinnedRooms[member.id] ? '\u{1f4cc} ' : '') + member.name;
+        if (member.explanation) tag.title = explainMember(member.explanation);
+        tag.addEventListener('click', () => {
+            const studentCard = document.querySelector('[data-student-id="' + member.id + '"]');
+            if (!studentCard) return;
+            const cDet = [...studentCard.querySelectorAll('wa-details')].find(d => d.summary === 'Constraints');
+            if (cDet) cDet.open = true;
+            studentCard.scrollIntoView({ behavior: 'smooth', block: 'center' });
+        });
+        tags.appendChild(tag);
+    }
+    if (violations.length > 0) {
+        const warn = document.createElement('div');
+        warn.style.fontSize = '0.75rem';
+        warn.style.color = 'var(--wa-color-warning-50)';
+        warn.textContent = violations.map(v => v.from + ' \u2192 ' + v.to).join(', ');
+        card.appendChild(tags);
+        card.appendChild(warn);
+    } else {
+        card.appendChild(tags);
+    }
+    parent.appendChild(card);
+};
 
-        const solutions = result.solutions;
-        const roomKey = (room) => room.map(m => m.id).sort((a, b) => a - b).join(',');
-        let swapGroups = [];
+function renderExportControls(parent, method, path, body) {
+    const format = document.createElement('select');
+    for (const [value, label] of [['pdf', 'PDF'], ['csv', 'CSV'], ['html', 'Print']]) {
+        const opt = document.createElement('option');
+        opt.value = value;
+        opt.textContent = label;
+        format.appendChild(opt);
+    }
+    const contactsLabel = document.createElement('label');
+    contactsLabel.className = 'pin-label';
+    const contacts = document.createElement('input');
+    contacts.type = 'checkbox';
+    contactsLabel.appendChild(contacts);
+    contactsLabel.appendChild(document.createTextNode('Contacts'));
+    const btn = document.createElement('wa-button');
+    btn.size = 'small';
+    btn.textContent = 'Export';
+    btn.addEventListener('click', async () => {
+        const query = '?format=' + format.value + (contacts.checked ? '&contacts=1' : '');
+        const blob = await apiBlob(method, path + query, typeof body === 'function' ? body() : body);
+        const url = URL.createObjectURL(blob);
+        if (format.value === 'html') {
+            window.open(url);
+        } else {
+            const a = document.createElement('a');
+            a.href = url;
+            a.download = 'rooms.' + format.value;
+            a.click();
+        }
+        setTimeout(() => URL.revokeObjectURL(url), 60000);
+    });
+    parent.appendChild(format);
+    parent.appendChild(contactsLabel);
+    parent.appendChild(btn);
+}
 
-        if (solutions.length === 1) {
-            let roomNum = 1;
-            for (const room of solutions[0].rooms) {
-                renderRoomCard(room, container, roomNum++, false);
+async function loadAssignments() {
+    const assignments = await api('GET', '/api/trips/' + tripID + '/assignments');
+    const container = document.getElementById('assignments');
+    container.innerHTML = '';
+    if (assignments.length === 0) return;
+    const det = document.createElement('wa-details');
+    det.summary = 'Saved Rooming Lists (' + assignments.length + ')';
+    for (const a of assignments) {
+        const row = document.createElement('div');
+        row.className = 'assignment-row';
+        const label = document.createElement('span');
+        label.style.flex = '1';
+        label.textContent = a.name + ' v' + a.version + ' (score ' + a.score + ')';
+        row.appendChild(label);
+        if (a.published) {
+            const tag = document.createElement('wa-tag');
+            tag.size = 'small';
+            tag.variant = 'success';
+            tag.textContent = 'Published';
+            row.appendChild(tag);
+        }
+        const viewBtn = document.createElement('wa-button');
+        viewBtn.size = 'small';
+        viewBtn.textContent = 'View';
+        viewBtn.addEventListener('click', async () => {
+            const full = await api('GET', '/api/trips/' + tripID + '/assignments/' + a.id);
+            const results = document.getElementById('solver-results');
+            results.innerHTML = '';
+            for (const room of full.rooms) {
+                renderRoomCard(room, results, false);
             }
-        } else if (solutions.length > 1) {
-            const sets = solutions.map(sol => new Set(sol.rooms.map(roomKey)));
-            const lockedKeys = new Set([...sets[0]].filter(k => sets.every(s => s.has(k))));
+            const scoreDiv = document.createElement('div');
+            scoreDiv.className = 'solver-score';
+            scoreDiv.textContent = full.name + ' v' + full.version + ' \u2014 Score: ' + full.score;
+            results.appendChild(scoreDiv);
+            const exportRow = document.createElement('div');
+            exportRow.className = 'constraint-add';
+            renderExportControls(exportRow, 'GET', '/api/trips/' + tripID + '/assignments/' + a.id + '/export');
+            results.appendChild(exportRow);
+        });
+        row.appendChild(viewBtn);
+        if (!a.published) {
+            const pubBtn = document.createElement('wa-button');
+            pubBtn.size = 'small';
+            pubBtn.textContent = 'Publish';
+            pubBtn.addEventListener('click', async () => {
+                if (!confirm('Publish "' + a.name + ' v' + a.version + '"?')) return;
+                await api('POST', '/api/trips/' + tripID + '/assignments/' + a.id + '/publish');
+                await loadAssignments();
+                document.querySelector('#assignments wa-details').open = true;
+            });
+            row.appendChild(pubBtn);
+        }
+        det.appendChild(row);
+    }
+    container.appendChild(det);
+}
 
-            const lockedRoomsList = solutions[0].rooms.filter(r => lockedKeys.has(roomKey(r)));
+function renderSolutions(solutions) {
+    const container = document.getElementById('solver-results');
+    container.innerHTML = '';
 
-            const uf = {};
-            const ufFind = (x) => {
-                if (uf[x] === undefined) uf[x] = x;
-                if (uf[x] !== x) uf[x] = ufFind(uf[x]);
-                return uf[x];
-            };
-            const ufUnion = (a, b) => {
-                const ra = ufFind(a), rb = ufFind(b);
-                if (ra !== rb) uf[ra] = rb;
-            };
+    const roomKey = (room) => room.members.map(m => m.id).sort((a, b) => a - b).join(',');
+    let swapGroups = [];
+    let lockedRoomsList = [];
+    const selectedConfigs = [];
 
-            for (const sol of solutions) {
-                for (const room of sol.rooms) {
-                    if (lockedKeys.has(roomKey(room))) continue;
-                    const ids = room.map(m => m.id);
-                    for (let i = 1; i < ids.length; i++) {
-                        ufUnion(ids[0], ids[i]);
-                    }
+    if (solutions.length === 1) {
+        for (const room of solutions[0].rooms) {
+            renderRoomCard(room, container, false);
+        }
+    } else if (solutions.length > 1) {
+        const sets = solutions.map(sol => new Set(sol.rooms.map(roomKey)));
+        const lockedKeys = new Set([...sets[0]].filter(k => sets.every(s => s.has(k))));
+
+        lockedRoomsList = solutions[0].rooms.filter(r => lockedKeys.has(roomKey(r)));
+
+        const uf = {};
+        const ufFind = (x) => {
+            if (uf[x] === undefined) uf[x] = x;
+            if (uf[x] !== x) uf[x] = ufFind(uf[x]);
+            return uf[x];
+        };
+        const ufUnion = (a, b) => {
+            const ra = ufFind(a), rb = ufFind(b);
+            if (ra !== rb) uf[ra] = rb;
+        };
+
+        for (const sol of solutions) {
+            for (const room of sol.rooms) {
+                if (lockedKeys.has(roomKey(room))) continue;
+                const ids = room.members.map(m => m.id);
+                for (let i = 1; i < ids.length; i++) {
+                    ufUnion(ids[0], ids[i]);
                 }
             }
+        }
 
-            const components = {};
-            for (const id of Object.keys(uf)) {
-                const root = ufFind(parseInt(id));
-                if (!components[root]) components[root] = new Set();
-                components[root].add(parseInt(id));
-            }
+        const components = {};
+        for (const id of Object.keys(uf)) {
+            const root = ufFind(parseInt(id));
+            if (!components[root]) components[root] = new Set();
+            components[root].add(parseInt(id));
+        }
 
-            for (const studentIDs of Object.values(components)) {
-                const configs = [];
-                const configKeySet = new Set();
-                for (const sol of solutions) {
-                    const groupRooms = sol.rooms.filter(r => r.some(m => studentIDs.has(m.id)));
-                    groupRooms.sort((a, b) => roomKey(a).localeCompare(roomKey(b)));
-                    const ck = groupRooms.map(r => roomKey(r)).join('|');
-                    if (!configKeySet.has(ck)) {
-                        configKeySet.add(ck);
-                        configs.push(groupRooms);
-                    }
+        for (const studentIDs of Object.values(components)) {
+            const configs = [];
+            const configKeySet = new Set();
+            for (const sol of solutions) {
+                const groupRooms = sol.rooms.filter(r => r.members.some(m => studentIDs.has(m.id)));
+                groupRooms.sort((a, b) => roomKey(a).localeCompare(roomKey(b)));
+                const ck = groupRooms.map(r => roomKey(r)).join('|');
+                if (!configKeySet.has(ck)) {
+                    configKeySet.add(ck);
+                    configs.push(groupRooms);
                 }
-                swapGroups.push({ studentIDs, configs });
             }
-            swapGroups.sort((a, b) => Math.min(...a.studentIDs) - Math.min(...b.studentIDs));
+            swapGroups.push({ studentIDs, configs });
+        }
+        swapGroups.sort((a, b) => Math.min(...a.studentIDs) - Math.min(...b.studentIDs));
 
-            let roomNum = 1;
-            for (const room of lockedRoomsList) {
-                renderRoomCard(room, container, roomNum++, true);
-            }
+        for (const room of lockedRoomsList) {
+            renderRoomCard(room, container, true);
+        }
 
-            for (let gi = 0; gi < swapGroups.length; gi++) {
-                const group = swapGroups[gi];
-                const prefix = String.fromCharCode('A'.charCodeAt(0) + gi);
-                const section = document.createElement('div');
-                section.className = 'swap-group';
-                const baseRoomNum = roomNum;
-
-                const tabGroup = document.createElement('wa-tab-group');
-                for (let ci = 0; ci < group.configs.length; ci++) {
-                    const tab = document.createElement('wa-tab');
-                    tab.slot = 'nav';
-                    tab.panel = 'sg-' + gi + '-' + ci;
-                    tab.textContent = prefix + (ci + 1);
-                    tabGroup.appendChild(tab);
-                }
-                for (let ci = 0; ci < group.configs.length; ci++) {
-                    const panel = document.createElement('wa-tab-panel');
-                    panel.name = 'sg-' + gi + '-' + ci;
-                    let rn = baseRoomNum;
-                    for (const room of group.configs[ci]) {
-                        renderRoomCard(room, panel, rn++, false);
-                    }
-                    tabGroup.appendChild(panel);
-                }
+        for (let gi = 0; gi < swapGroups.length; gi++) {
+            const group = swapGroups[gi];
+            const prefix = String.fromCharCode('A'.charCodeAt(0) + gi);
+            const section = document.createElement('div');
+            section.className = 'swap-group';
 
-                section.appendChild(tabGroup);
-                container.appendChild(section);
-                roomNum += group.configs[0].length;
+            const tabGroup = document.createElement('wa-tab-group');
+            selectedConfigs[gi] = 0;
+            tabGroup.addEventListener('wa-tab-show', (e) => {
+                selectedConfigs[gi] = parseInt(e.detail.name.split('-').pop());
+            });
+            for (let ci = 0; ci < group.configs.length; ci++) {
+                const tab = document.createElement('wa-tab');
+                tab.slot = 'nav';
+                tab.panel = 'sg-' + gi + '-' + ci;
+                tab.textContent = prefix + (ci + 1);
+                tabGroup.appendChild(tab);
             }
+            for (let ci = 0; ci < group.configs.length; ci++) {
+                const panel = document.createElement('wa-tab-panel');
+                panel.name = 'sg-' + gi + '-' + ci;
+                for (const room of group.configs[ci]) {
+                    renderRoomCard(room, panel, false);
+                }
+                tabGroup.appendChild(panel);
+            }
+
+            section.appendChild(tabGroup);
+            container.appendChild(section);
         }
+    }
 
-        const scoreDiv = document.createElement('div');
-        scoreDiv.className = 'solver-score';
-        let scoreText = 'Score: ' + (solutions[0]?.score ?? 0);
-        if (swapGroups.length > 0) {
-            const counts = swapGroups.map(g => g.configs.length);
-            const total = counts.reduce((a, b) => a * b, 1);
-            if (swapGroups.length === 1) {
-                scoreText += ' (' + total + ' options)';
-            } else {
-                scoreText += ' (' + counts.join(' \u00d7 ') + ' = ' + total + ' combinations)';
-            }
+    const scoreDiv = document.createElement('div');
+    scoreDiv.className = 'solver-score';
+    let scoreText = 'Score: ' + (solutions[0]?.score ?? 0);
+    if (solutions[0]?.worst !== undefined) scoreText += ', worst-off student: ' + solutions[0].worst;
+    if (swapGroups.length > 0) {
+        const counts = swapGroups.map(g => g.configs.length);
+        const total = counts.reduce((a, b) => a * b, 1);
+        if (swapGroups.length === 1) {
+            scoreText += ' (' + total + ' options)';
+        } else {
+            scoreText += ' (' + counts.join(' \u00d7 ') + ' = ' + total + ' combinations)';
         }
-        scoreDiv.textContent = scoreText;
-        container.appendChild(scoreDiv);
+    }
+    scoreDiv.textContent = scoreText;
+    container.appendChild(scoreDiv);
+
+    if (solutions.length > 0) {
+        const saveRow = document.createElement('div');
+        saveRow.className = 'constraint-add';
+        const nameInput = document.createElement('wa-input');
+        nameInput.size = 'small';
+        nameInput.placeholder = 'Save as\u2026';
+        const saveBtn = document.createElement('wa-button');
+        saveBtn.size = 'small';
+        saveBtn.textContent = 'Save';
+        const chosenRooms = () => {
+            if (solutions.length === 1) return solutions[0].rooms;
+            const rooms = [...lockedRoomsList];
+            swapGroups.forEach((g, gi) => rooms.push(...g.configs[selectedConfigs[gi]]));
+            return rooms;
+        };
+        saveBtn.addEventListener('click', async () => {
+            const name = (nameInput.value || '').trim();
+            if (!name) return;
+            const rooms = chosenRooms();
+            await api('POST', '/api/trips/' + tripID + '/assignments', { name, rooms });
+            nameInput.value = '';
+            await loadAssignments();
+            document.querySelector('#assignments wa-details').open = true;
+        });
+        saveRow.appendChild(nameInput);
+        saveRow.appendChild(saveBtn);
+        container.appendChild(saveRow);
+
+        const exportRow = document.createElement('div');
+        exportRow.className = 'constraint-add';
+        renderExportControls(exportRow, 'POST', '/api/trips/' + tripID + '/export', () => ({ rooms: chosenRooms() }));
+        container.appendChild(exportRow);
+    }
+}
+
+let solveJobID = null;
+
+document.getElementById('add-student-btn').addEventListener('click', addStudent);
+document.getElementById('solve-btn').addEventListener('click', async () => {
+    const btn = document.getElementById('solve-btn');
+    const cancelBtn = document.getElementById('cancel-solve-btn');
+    const status = document.getElementById('solver-status');
+    btn.loading = true;
+    cancelBtn.style.display = '';
+    try {
+        const backend = document.getElementById('solver-backend').value;
+        const body = { backend };
+        const seconds = parseInt(document.getElementById('solver-time').value);
+        if (seconds > 0) body.time_limit = seconds;
+        let job = await api('POST', '/api/trips/' + tripID + '/solve-jobs', body);
+        solveJobID = job.id;
+        while (job.status === 'running') {
+            const count = job.progress.iterations + (job.progress.total ? '/' + job.progress.total : backend === 'exact' ? ' nodes' : ' iterations');
+            status.textContent = 'Solving\u2026 ' + count + ' (best score ' + job.progress.best_score + ')';
+            await new Promise(resolve => setTimeout(resolve, 500));
+            job = await api('GET', '/api/trips/' + tripID + '/solve-jobs/' + job.id);
+        }
+        if (job.status === 'failed') throw new Error(job.error);
+        status.textContent = job.status === 'cancelled'
+            ? 'Cancelled after ' + job.progress.iterations + (job.progress.total ? ' of ' + job.progress.total : '') + ' iterations'
+            : '';
+        if (job.optimal) status.textContent = 'Proven optimal';
+        else if (job.bound !== undefined && job.solutions?.length) status.textContent += (status.textContent ? '; ' : '') + 'best possible score is at most ' + job.bound;
+        if (job.stats) status.textContent += (status.textContent ? '; ' : '') + job.stats.iterations + ' iterations, best found after ' + (job.stats.best_found_after_ms / 1000).toFixed(1) + 's';
+        renderSolutions(job.solutions || []);
     } catch (e) {
+        status.textContent = '';
         const container = document.getElementById('solver-results');
-        container.textContent = e.message || 'Solver failed';
+        let diagnostics = null;
+        try { diagnostics = JSON.parse(e.message).diagnostics; } catch {}
+        if (!diagnostics) {
+            container.textContent = e.message || 'Solver failed';
+            return;
+        }
+        container.innerHTML = '';
+        const heading = document.createElement('div');
+        heading.textContent = 'These rooms cannot be solved (' + diagnostics.students + ' students, ' + diagnostics.capacity + ' beds):';
+        container.appendChild(heading);
+        const list = document.createElement('ul');
+        for (const problem of diagnostics.problems) {
+            const li = document.createElement('li');
+            li.textContent = problem;
+            list.appendChild(li);
+        }
+        container.appendChild(list);
     } finally {
         btn.loading = false;
+        cancelBtn.style.display = 'none';
+        solveJobID = null;
     }
 });
+document.getElementById('cancel-solve-btn').addEventListener('click', async () => {
+    if (solveJobID) await api('DELETE', '/api/trips/' + tripID + '/solve-jobs/' + solveJobID);
+});
 document.getElementById('new-student-name').addEventListener('keydown', (e) => { if (e.key === 'Enter') addStudent(); });
 document.getElementById('new-student-email').addEventListener('keydown', (e) => { if (e.key === 'Enter') addStudent(); });
 await loadStudents();
+await loadAssignments();
 await customElements.whenDefined('wa-button');
 document.body.style.opacity = 1;
 
@@ -642,9 +1218,10 @@ if (DOMAIN) {
 }
 
 async function renderMemberView(me) {
-    const [students, constraintData] = await Promise.all([
+    const [students, constraintData, myRooms] = await Promise.all([
         api('GET', '/api/trips/' + tripID + '/students'),
-        api('GET', '/api/trips/' + tripID + '/constraints')
+        api('GET', '/api/trips/' + tripID + '/constraints'),
+        api('GET', '/api/trips/' + tripID + '/me/room')
     ]);
     const constraints = constraintData.constraints;
 
@@ -666,6 +1243,33 @@ async function renderMemberView(me) {
         label.textContent = myStudent.name;
         card.appendChild(label);
 
+        const windowNote = document.createElement('div');
+        windowNote.className = 'window-note';
+        const win = myStudent.window;
+        if (!myStudent.open) {
+            windowNote.textContent = win.opens_at && new Date(win.opens_at) > new Date()
+                ? 'Preferences open ' + new Date(win.opens_at).toLocaleString() + '.'
+                : 'Preferences are closed.';
+        } else if (win?.closes_at) {
+            windowNote.textContent = 'Preferences close ' + new Date(win.closes_at).toLocaleString() + '.';
+        }
+        if (windowNote.textContent) card.appendChild(windowNote);
+
+        const myRoom = myRooms.rooms.find(r => r.student_id === myStudent.id);
+        if (myRoom) {
+            const roomNote = document.createElement('div');
+            roomNote.className = 'my-room';
+            const where = [myRoom.building, myRoom.floor && 'floor ' + myRoom.floor].filter(Boolean).join(', ');
+            roomNote.textContent = (myRoom.name || 'Room ' + myRoom.room) + (where ? ' (' + where + ')' : '') + ': '
+                + (myRoom.roommates.length ? 'with ' + myRoom.roommates.join(', ') : 'no roommates');
+            card.appendChild(roomNote);
+        } else if (myRooms.published) {
+            const roomNote = document.createElement('div');
+            roomNote.className = 'window-note';
+            roomNote.textContent = 'Rooms are published, but ' + myStudent.name + ' has not been placed yet.';
+            card.appendChild(roomNote);
+        }
+
         const myConstraints = {};
         for (const c of constraints) {
             if (c.student_a_id === myStudent.id) {
@@ -696,9 +1300,29 @@ async function renderMemberView(me) {
             }
             const existing = myConstraints[other.id];
             pendingRadios.push({ group, value: existing ? existing.kind : '' });
+            if (!myStudent.open) group.disabled = true;
 
-            group.addEventListener('change', async (e) => {
-                const val = e.target.value;
+            let rankSelect = null;
+            if (kindOptions.includes('prefer')) {
+                rankSelect = document.createElement('select');
+                rankSelect.className = 'pref-rank';
+                const unranked = document.createElement('option');
+                unranked.value = '';
+                unranked.textContent = 'Any choice';
+                rankSelect.appendChild(unranked);
+                for (let rank = 1; rank <= trip.rank_weights.length; rank++) {
+                    const opt = document.createElement('option');
+                    opt.value = rank;
+                    opt.textContent = ordinal(rank) + ' choice';
+                    rankSelect.appendChild(opt);
+                }
+                rankSelect.value = existing?.rank ?? '';
+                rankSelect.style.visibility = existing?.kind === 'prefer' ? 'visible' : 'hidden';
+                if (!myStudent.open) rankSelect.disabled = true;
+            }
+
+            const save = async (val) => {
+                if (rankSelect) rankSelect.style.visibility = val === 'prefer' ? 'visible' : 'hidden';
                 if (val === '') {
                     const c = myConstraints[other.id];
                     if (c) {
@@ -706,16 +1330,21 @@ async function renderMemberView(me) {
                         delete myConstraints[other.id];
                     }
                 } else {
+                    const rank = val === 'prefer' && rankSelect?.value ? parseInt(rankSelect.value) : null;
                     const result = await api('POST', '/api/trips/' + tripID + '/constraints', {
                         student_a_id: myStudent.id,
                         student_b_id: other.id,
                         kind: val,
-                        level: me.role
+                        level: me.role,
+                        rank
                     });
-                    myConstraints[other.id] = { id: result.id, kind: val, student_a_id: myStudent.id, student_b_id: other.id };
+                    myConstraints[other.id] = { id: result.id, kind: val, rank, student_a_id: myStudent.id, student_b_id: other.id };
                 }
-            });
+            };
+            group.addEventListener('change', (e) => save(e.target.value));
+            rankSelect?.addEventListener('change', () => save('prefer'));
             row.appendChild(group);
+            if (rankSelect) row.appendChild(rankSelect);
             rows.appendChild(row);
         }
         card.appendChild(rows);
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// Store is the storage behind the trip, student, parent, constraint and room
+// group handlers, along with the sessions and audit log they rely on. The
+// Delete and Remove methods report whether anything matched.
+type Store interface {
+	CreateSession(id, email string, issuedAt, expiresAt, idleExpiresAt time.Time) error
+	ActiveSession(id string) (string, bool)
+	RevokeSession(id string) error
+	RevokeSessions(email string) error
+	IsGlobalAdmin(email string) bool
+	IsTripAdmin(email string, tripID int64) bool
+
+	ListTrips() ([]tripSummary, error)
+	Trip(tripID int64) (tripRecord, error)
+	CreateTrip(name string, layout *tripLayout) (int64, error)
+	TripTemplate(templateID int64) (tripLayout, error)
+	UpdateTrip(tripID int64, u tripUpdate) error
+	DeleteTrip(tripID int64) (bool, error)
+	AddTripAdmin(tripID int64, email string) (int64, error)
+	RemoveTripAdmin(adminID int64) (bool, error)
+	PreferenceWindow(tripID int64, level string, studentID int64) (preferenceWindow, error)
+	MaxRoomCapacity(tripID int64) (int, error)
+
+	ListStudents(tripID int64) ([]studentRecord, error)
+	StudentsByEmail(tripID int64, email string) ([]int64, error)
+	StudentsByParentEmail(tripID int64, email string) ([]int64, error)
+	CreateStudent(tripID int64, name, email string) (int64, error)
+	DeleteStudent(tripID, studentID int64) (bool, error)
+	AddParent(tripID, studentID int64, email string) (int64, error)
+	RemoveParent(tripID, parentID int64) (bool, error)
+
+	// ListConstraints returns every constraint of the trip, or with level set
+	// only that level's constraints made by studentAIDs.
+	ListConstraints(tripID int64, level string, studentAIDs []int64) ([]constraintRecord, error)
+	FindConstraint(studentAID, studentBID int64, level string) (int64, bool)
+	SetConstraint(tripID int64, c constraintRecord) (int64, error)
+	DeleteConstraint(tripID, constraintID int64, level string, studentAIDs []int64) (bool, error)
+
+	ListRoomGroups(tripID int64) ([]roomGroupRecord, error)
+	CreateRoomGroup(tripID int64, g newRoomGroup) (int64, error)
+	DeleteRoomGroup(tripID, groupID int64) (bool, error)
+
+	RecordAudit(e auditEntry)
+	AuditRow(table string, id int64) auditRow
+}
+
+type tripAdmin struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+type tripSummary struct {
+	ID                int64       `json:"id"`
+	Name              string      `json:"name"`
+	PreferNotMultiple int         `json:"prefer_not_multiple"`
+	NoPreferCost      int         `json:"no_prefer_cost"`
+	Admins            []tripAdmin `json:"admins"`
+}
+
+type tripRecord struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	tripSettings
+	StudentOpensAt  *time.Time `json:"student_opens_at"`
+	StudentClosesAt *time.Time `json:"student_closes_at"`
+	ParentOpensAt   *time.Time `json:"parent_opens_at"`
+	ParentClosesAt  *time.Time `json:"parent_closes_at"`
+}
+
+// tripUpdate holds the trip fields a PATCH sets. Windows maps a window column
+// to its new value, where nil clears it.
+type tripUpdate struct {
+	PreferNotMultiple *int
+	NoPreferCost      *int
+	RankWeights       []int64
+	Objective         *string
+	FairnessWeight    *int
+	SingletonCost     *int
+	MinOccupancy      *int
+	UnderfillCost     *int
+	ImbalanceCost     *int
+	Windows           map[string]*time.Time
+}
+
+func (u tripUpdate) apply(t *tripRecord) {
+	for _, f := range []struct {
+		dst *int
+		src *int
+	}{
+		{&t.PreferNotMultiple, u.PreferNotMultiple},
+		{&t.NoPreferCost, u.NoPreferCost},
+		{&t.FairnessWeight, u.FairnessWeight},
+		{&t.SingletonCost, u.SingletonCost},
+		{&t.MinOccupancy, u.MinOccupancy},
+		{&t.UnderfillCost, u.UnderfillCost},
+		{&t.ImbalanceCost, u.ImbalanceCost},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if u.RankWeights != nil {
+		t.RankWeights = u.RankWeights
+	}
+	if u.Objective != nil {
+		t.Objective = *u.Objective
+	}
+	windows := map[string]**time.Time{
+		"student_opens_at":  &t.StudentOpensAt,
+		"student_closes_at": &t.StudentClosesAt,
+		"parent_opens_at":   &t.ParentOpensAt,
+		"parent_closes_at":  &t.ParentClosesAt,
+	}
+	for column, value := range u.Windows {
+		*windows[column] = value
+	}
+}
+
+type parentRecord struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+type studentRecord struct {
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Email      string            `json:"email"`
+	Parents    []parentRecord    `json:"parents"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type constraintRecord struct {
+	ID           int64  `json:"id"`
+	StudentAID   int64  `json:"student_a_id"`
+	StudentAName string `json:"student_a_name"`
+	StudentBID   int64  `json:"student_b_id"`
+	StudentBName string `json:"student_b_name"`
+	Kind         string `json:"kind"`
+	Level        string `json:"level"`
+	Rank         *int   `json:"rank"`
+}
+
+type roomGroupRecord struct {
+	ID    int64 `json:"id"`
+	Size  int   `json:"size"`
+	Count int   `json:"count"`
+}
+
+type newRoomGroup struct {
+	Size        int
+	Count       int
+	Building    string
+	Floor       string
+	StartNumber *int
+}
+
+// roomNames numbers the rooms from StartNumber, or leaves them unnamed.
+func (g newRoomGroup) roomNames() []string {
+	names := make([]string, g.Count)
+	if g.StartNumber != nil {
+		for i := range names {
+			names[i] = strconv.Itoa(*g.StartNumber + i)
+		}
+	}
+	return names
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// tripLayout is everything about a trip that carries over from one year to
+// the next: scoring settings, rooms with their rules, and the admin list.
+// Preference windows and anything tied to particular students are left out.
+type tripLayout struct {
+	Settings   tripSettings      `json:"settings"`
+	RoomGroups []layoutRoomGroup `json:"room_groups"`
+	Admins     []string          `json:"admins"`
+}
+
+type tripSettings struct {
+	PreferNotMultiple int     `json:"prefer_not_multiple"`
+	NoPreferCost      int     `json:"no_prefer_cost"`
+	RankWeights       []int64 `json:"rank_weights"`
+	Objective         string  `json:"objective"`
+	FairnessWeight    int     `json:"fairness_weight"`
+	SingletonCost     int     `json:"singleton_cost"`
+	MinOccupancy      int     `json:"min_occupancy"`
+	UnderfillCost     int     `json:"underfill_cost"`
+	ImbalanceCost     int     `json:"imbalance_cost"`
+}
+
+type layoutRoomGroup struct {
+	Size  int          `json:"size"`
+	Count int          `json:"count"`
+	Rooms []layoutRoom `json:"rooms"`
+	Rules []layoutRule `json:"rules"`
+}
+
+type layoutRoom struct {
+	Name     string       `json:"name"`
+	Floor    string       `json:"floor"`
+	Building string       `json:"building"`
+	Capacity int          `json:"capacity"`
+	Rules    []layoutRule `json:"rules"`
+}
+
+type layoutRule struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func loadTripLayout(db *sql.DB, tripID int64) (tripLayout, error) {
+	var l tripLayout
+	s := &l.Settings
+	err := db.QueryRow(`
+		SELECT prefer_not_multiple, no_prefer_cost, rank_weights, objective, fairness_weight,
+			singleton_cost, min_occupancy, underfill_cost, imbalance_cost
+		FROM trips WHERE id = $1`, tripID).Scan(
+		&s.PreferNotMultiple, &s.NoPreferCost, pq.Array(&s.RankWeights), &s.Objective, &s.FairnessWeight,
+		&s.SingletonCost, &s.MinOccupancy, &s.UnderfillCost, &s.ImbalanceCost)
+	if err != nil {
+		return l, err
+	}
+
+	type ruleRow struct {
+		groupID, roomID *int64
+		rule            layoutRule
+	}
+	var rules []ruleRow
+	rows, err := db.Query(`
+		SELECT rr.room_group_id, rr.room_id, rr.key, rr.value
+		FROM room_rules rr
+		LEFT JOIN rooms r ON r.id = rr.room_id
+		JOIN room_groups rg ON rg.id = COALESCE(rr.room_group_id, r.room_group_id)
+		WHERE rg.trip_id = $1
+		ORDER BY rr.id`, tripID)
+	if err != nil {
+		return l, err
+	}
+	for rows.Next() {
+		var rr ruleRow
+		if err := rows.Scan(&rr.groupID, &rr.roomID, &rr.rule.Key, &rr.rule.Value); err != nil {
+			rows.Close()
+			return l, err
+		}
+		rules = append(rules, rr)
+	}
+	rows.Close()
+	rulesFor := func(groupID, roomID int64) []layoutRule {
+		list := []layoutRule{}
+		for _, rr := range rules {
+			if (rr.groupID != nil && *rr.groupID == groupID) || (rr.roomID != nil && *rr.roomID == roomID) {
+				list = append(list, rr.rule)
+			}
+		}
+		return list
+	}
+
+	rows, err = db.Query("SELECT id, size, count FROM room_groups WHERE trip_id = $1 ORDER BY id", tripID)
+	if err != nil {
+		return l, err
+	}
+	groupIndex := map[int64]int{}
+	for rows.Next() {
+		var groupID int64
+		g := layoutRoomGroup{Rooms: []layoutRoom{}}
+		if err := rows.Scan(&groupID, &g.Size, &g.Count); err != nil {
+			rows.Close()
+			return l, err
+		}
+		g.Rules = rulesFor(groupID, 0)
+		groupIndex[groupID] = len(l.RoomGroups)
+		l.RoomGroups = append(l.RoomGroups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return l, err
+	}
+
+	rooms, err := loadTripRooms(db, tripID)
+	if err != nil {
+		return l, err
+	}
+	for _, room := range rooms {
+		i, ok := groupIndex[room.RoomGroupID]
+		if !ok {
+			continue
+		}
+		l.RoomGroups[i].Rooms = append(l.RoomGroups[i].Rooms, layoutRoom{
+			Name: room.Name, Floor: room.Floor, Building: room.Building, Capacity: room.Capacity, Rules: rulesFor(0, room.ID),
+		})
+	}
+
+	rows, err = db.Query("SELECT email FROM trip_admins WHERE trip_id = $1 ORDER BY id", tripID)
+	if err != nil {
+		return l, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return l, err
+		}
+		l.Admins = append(l.Admins, email)
+	}
+	return l, rows.Err()
+}
+
+// createTrip inserts a new trip laid out like l.
+func (l tripLayout) createTrip(tx *sql.Tx, name string) (int64, error) {
+	s := l.Settings
+	var tripID int64
+	err := tx.QueryRow(`
+		INSERT INTO trips (name, prefer_not_multiple, no_prefer_cost, rank_weights, objective, fairness_weight,
+			singleton_cost, min_occupancy, underfill_cost, imbalance_cost)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		name, s.PreferNotMultiple, s.NoPreferCost, pq.Array(s.RankWeights), s.Objective, s.FairnessWeight,
+		s.SingletonCost, s.MinOccupancy, s.UnderfillCost, s.ImbalanceCost).Scan(&tripID)
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range l.RoomGroups {
+		var groupID int64
+		if err := tx.QueryRow("INSERT INTO room_groups (trip_id, size, count) VALUES ($1, $2, $3) RETURNING id", tripID, g.Size, g.Count).Scan(&groupID); err != nil {
+			return 0, err
+		}
+		for _, rule := range g.Rules {
+			if _, err := tx.Exec("INSERT INTO room_rules (room_group_id, key, value) VALUES ($1, $2, $3)", groupID, rule.Key, rule.Value); err != nil {
+				return 0, err
+			}
+		}
+		for _, room := range g.Rooms {
+			var roomID int64
+			err := tx.QueryRow("INSERT INTO rooms (room_group_id, name, floor, building, capacity) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+				groupID, room.Name, room.Floor, room.Building, room.Capacity).Scan(&roomID)
+			if err != nil {
+				return 0, err
+			}
+			for _, rule := range room.Rules {
+				if _, err := tx.Exec("INSERT INTO room_rules (room_id, key, value) VALUES ($1, $2, $3)", roomID, rule.Key, rule.Value); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	for _, email := range l.Admins {
+		if _, err := tx.Exec("INSERT INTO trip_admins (trip_id, email) VALUES ($1, $2) ON CONFLICT DO NOTHING", tripID, email); err != nil {
+			return 0, err
+		}
+	}
+	return tripID, nil
+}
+
+// copyRoster copies students with their parents and attributes, matching
+// them up by email. Constraints, pins and assignments stay behind.
+func copyRoster(tx *sql.Tx, fromTripID, toTripID int64) error {
+	if _, err := tx.Exec("INSERT INTO students (trip_id, name, email) SELECT $2, name, email FROM students WHERE trip_id = $1", fromTripID, toTripID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO parents (student_id, email)
+		SELECT ns.id, p.email
+		FROM parents p
+		JOIN students os ON os.id = p.student_id
+		JOIN students ns ON ns.trip_id = $2 AND ns.email = os.email
+		WHERE os.trip_id = $1`, fromTripID, toTripID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO student_attributes (student_id, key, value)
+		SELECT ns.id, sa.key, sa.value
+		FROM student_attributes sa
+		JOIN students os ON os.id = sa.student_id
+		JOIN students ns ON ns.trip_id = $2 AND ns.email = os.email
+		WHERE os.trip_id = $1`, fromTripID, toTripID)
+	return err
+}
+
+func handleCloneTrip(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		sourceID, err := strconv.ParseInt(r.PathValue("tripID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid trip ID", http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Name     string `json:"name"`
+			Students bool   `json:"students"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		layout, err := loadTripLayout(db, sourceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "trip not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		id, err := layout.createTrip(tx, body.Name)
+		if err == nil && body.Students {
+			err = copyRoster(tx, sourceID, id)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: id, Actor: email, Role: "global_admin", Action: "trip.clone", Before: map[string]any{"trip_id": sourceID}, After: loadAuditRow(db, "trips", "id", id)})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "name": body.Name})
+	}
+}
+
+func handleListTripTemplates(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireAdmin(postgresStore{db}, w, r); !ok {
+			return
+		}
+		rows, err := db.Query("SELECT id, name, created_by, created_at FROM trip_templates ORDER BY name")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		type tripTemplate struct {
+			ID        int64     `json:"id"`
+			Name      string    `json:"name"`
+			CreatedBy string    `json:"created_by"`
+			CreatedAt time.Time `json:"created_at"`
+		}
+		templates := []tripTemplate{}
+		for rows.Next() {
+			var t tripTemplate
+			if err := rows.Scan(&t.ID, &t.Name, &t.CreatedBy, &t.CreatedAt); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			templates = append(templates, t)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates)
+	}
+}
+
+func handleCreateTripTemplate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Name   string `json:"name"`
+			TripID int64  `json:"trip_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.TripID == 0 {
+			http.Error(w, "name and trip_id are required", http.StatusBadRequest)
+			return
+		}
+		layout, err := loadTripLayout(db, body.TripID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "trip not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		raw, err := json.Marshal(layout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var id int64
+		err = db.QueryRow(`
+			INSERT INTO trip_templates (name, layout, created_by) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET layout = EXCLUDED.layout, created_by = EXCLUDED.created_by, created_at = now()
+			RETURNING id`, body.Name, raw, email).Scan(&id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{Actor: email, Role: "global_admin", Action: "trip_template.save", After: loadAuditRow(db, "trip_templates", "id", id)})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "name": body.Name})
+	}
+}
+
+func handleDeleteTripTemplate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := requireAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		templateID, err := strconv.ParseInt(r.PathValue("templateID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid template ID", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "trip_templates", "id", templateID)
+		result, err := db.Exec("DELETE FROM trip_templates WHERE id = $1", templateID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{Actor: email, Role: "global_admin", Action: "trip_template.delete", Before: before})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func loadTripTemplate(db *sql.DB, templateID int64) (tripLayout, error) {
+	var l tripLayout
+	var raw []byte
+	if err := db.QueryRow("SELECT layout FROM trip_templates WHERE id = $1", templateID).Scan(&raw); err != nil {
+		return l, err
+	}
+	err := json.Unmarshal(raw, &l)
+	return l, err
+}
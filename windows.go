@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type preferenceWindow struct {
+	OpensAt  *time.Time `json:"opens_at"`
+	ClosesAt *time.Time `json:"closes_at"`
+	Extended bool       `json:"extended"`
+}
+
+func (pw preferenceWindow) open(now time.Time) bool {
+	return (pw.OpensAt == nil || !now.Before(*pw.OpensAt)) && (pw.ClosesAt == nil || now.Before(*pw.ClosesAt))
+}
+
+func loadPreferenceWindow(db *sql.DB, tripID int64, level string, studentID int64) (preferenceWindow, error) {
+	var pw preferenceWindow
+	var extension *time.Time
+	err := db.QueryRow(`
+		SELECT
+			CASE WHEN $2 = 'student' THEN t.student_opens_at ELSE t.parent_opens_at END,
+			CASE WHEN $2 = 'student' THEN t.student_closes_at ELSE t.parent_closes_at END,
+			(SELECT we.closes_at FROM window_extensions we WHERE we.student_id = $3 AND we.level = $2::constraint_level)
+		FROM trips t WHERE t.id = $1`, tripID, level, studentID).Scan(&pw.OpensAt, &pw.ClosesAt, &extension)
+	if err != nil {
+		return pw, err
+	}
+	pw.extend(extension)
+	return pw, nil
+}
+
+// extend moves the window's close out to a student's extension, if it is
+// later.
+func (pw *preferenceWindow) extend(extension *time.Time) {
+	if extension != nil && (pw.ClosesAt == nil || extension.After(*pw.ClosesAt)) {
+		pw.ClosesAt = extension
+		pw.Extended = true
+	}
+}
+
+func requirePreferenceWindow(store Store, w http.ResponseWriter, tripID int64, level string, studentID int64) bool {
+	pw, err := store.PreferenceWindow(tripID, level, studentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	now := time.Now()
+	if pw.OpensAt != nil && now.Before(*pw.OpensAt) {
+		http.Error(w, "preferences open at "+pw.OpensAt.Format(time.RFC3339), http.StatusForbidden)
+		return false
+	}
+	if pw.ClosesAt != nil && !now.Before(*pw.ClosesAt) {
+		http.Error(w, "preferences closed at "+pw.ClosesAt.Format(time.RFC3339), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func handleListWindowExtensions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.Query(`
+			SELECT we.id, we.student_id, s.name, we.level::text, we.closes_at, we.granted_by
+			FROM window_extensions we
+			JOIN students s ON s.id = we.student_id
+			WHERE s.trip_id = $1
+			ORDER BY s.name, we.level`, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		type extension struct {
+			ID          int64     `json:"id"`
+			StudentID   int64     `json:"student_id"`
+			StudentName string    `json:"student_name"`
+			Level       string    `json:"level"`
+			ClosesAt    time.Time `json:"closes_at"`
+			GrantedBy   string    `json:"granted_by"`
+		}
+		var extensions []extension
+		for rows.Next() {
+			var e extension
+			if err := rows.Scan(&e.ID, &e.StudentID, &e.StudentName, &e.Level, &e.ClosesAt, &e.GrantedBy); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			extensions = append(extensions, e)
+		}
+		if extensions == nil {
+			extensions = []extension{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(extensions)
+	}
+}
+
+func handleSetWindowExtension(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			StudentID int64     `json:"student_id"`
+			Level     string    `json:"level"`
+			ClosesAt  time.Time `json:"closes_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.StudentID == 0 || body.ClosesAt.IsZero() {
+			http.Error(w, "student_id and closes_at are required", http.StatusBadRequest)
+			return
+		}
+		if body.Level != "student" && body.Level != "parent" {
+			http.Error(w, "level must be student or parent", http.StatusBadRequest)
+			return
+		}
+		var id int64
+		err := db.QueryRow(`
+			INSERT INTO window_extensions (student_id, level, closes_at, granted_by)
+			SELECT id, $2::constraint_level, $3, $4 FROM students WHERE id = $1 AND trip_id = $5
+			ON CONFLICT (student_id, level) DO UPDATE SET closes_at = EXCLUDED.closes_at, granted_by = EXCLUDED.granted_by
+			RETURNING id`, body.StudentID, body.Level, body.ClosesAt, email, tripID).Scan(&id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "student not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "window_extension.set", StudentIDs: []int64{body.StudentID}, After: body})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": id})
+	}
+}
+
+func handleDeleteWindowExtension(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, tripID, ok := requireTripAdmin(postgresStore{db}, w, r)
+		if !ok {
+			return
+		}
+		extensionID, err := strconv.ParseInt(r.PathValue("extensionID"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid extension ID", http.StatusBadRequest)
+			return
+		}
+		before := loadAuditRow(db, "window_extensions", "id", extensionID)
+		result, err := db.Exec(`DELETE FROM window_extensions WHERE id = $1 AND student_id IN (SELECT id FROM students WHERE trip_id = $2)`, extensionID, tripID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			http.Error(w, "extension not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(db, auditEntry{TripID: tripID, Actor: email, Role: "admin", Action: "window_extension.delete", StudentIDs: []int64{before.int64("student_id")}, Before: before})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
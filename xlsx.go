@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func readXLSXRows(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid xlsx file: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	readXML := func(name string, v any) error {
+		f := files[name]
+		if f == nil {
+			return fmt.Errorf("xlsx is missing %s", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(io.LimitReader(rc, 64<<20)).Decode(v)
+	}
+
+	var shared []string
+	if files["xl/sharedStrings.xml"] != nil {
+		var sst struct {
+			Items []struct {
+				T    string `xml:"t"`
+				Runs []struct {
+					T string `xml:"t"`
+				} `xml:"r"`
+			} `xml:"si"`
+		}
+		if err := readXML("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			s := si.T
+			for _, r := range si.Runs {
+				s += r.T
+			}
+			shared = append(shared, s)
+		}
+	}
+
+	sheet := "xl/worksheets/sheet1.xml"
+	var wb struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if readXML("xl/workbook.xml", &wb) == nil && len(wb.Sheets) > 0 && readXML("xl/_rels/workbook.xml.rels", &rels) == nil {
+		for _, rel := range rels.Rels {
+			if rel.ID == wb.Sheets[0].RID {
+				if strings.HasPrefix(rel.Target, "/") {
+					sheet = strings.TrimPrefix(rel.Target, "/")
+				} else {
+					sheet = path.Join("xl", rel.Target)
+				}
+			}
+		}
+	}
+
+	var ws struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					T string `xml:"t"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXML(sheet, &ws); err != nil {
+		return nil, err
+	}
+	var out [][]string
+	for _, row := range ws.Rows {
+		if row.Num > maxImportRows+1 {
+			return nil, fmt.Errorf("sheet has more than %d rows", maxImportRows)
+		}
+		for len(out) < row.Num-1 {
+			out = append(out, nil)
+		}
+		var cells []string
+		for i, c := range row.Cells {
+			col := xlsxColumn(c.Ref)
+			if col < 0 || col > 1024 {
+				col = i
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("cell %s has an invalid shared string index", c.Ref)
+				}
+				v = shared[n]
+			case "inlineStr":
+				v = c.Inline.T
+			default:
+				v = c.Value
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = v
+		}
+		out = append(out, cells)
+	}
+	return out, nil
+}
+
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// buildXLSX zips files into an in-memory workbook.
+func buildXLSX(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sheetXML(rows string) string {
+	return `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+func TestReadXLSXRows(t *testing.T) {
+	shared := `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<si><t>Name</t></si><si><t>Email</t></si><si><r><t>Ada </t></r><r><t>Lovelace</t></r></si></sst>`
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  [][]string
+		err   string
+	}{
+		{
+			name: "shared, inline and plain cells",
+			files: map[string]string{
+				"xl/sharedStrings.xml": shared,
+				"xl/worksheets/sheet1.xml": sheetXML(
+					`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+						`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2" t="inlineStr"><is><t>ada@example.com</t></is></c></row>` +
+						`<row r="4"><c r="B4"><v>42</v></c></row>`),
+			},
+			want: [][]string{{"Name", "Email"}, {"Ada Lovelace", "", "ada@example.com"}, nil, {"", "42"}},
+		},
+		{
+			name: "first sheet found through the workbook",
+			files: map[string]string{
+				"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+					`<sheets><sheet name="Roster" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+				"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+					`<Relationship Id="rId7" Target="worksheets/roster.xml"/></Relationships>`,
+				"xl/worksheets/roster.xml": sheetXML(`<row r="1"><c r="A1" t="inlineStr"><is><t>Name</t></is></c></row>`),
+			},
+			want: [][]string{{"Name"}},
+		},
+		{
+			name:  "missing sheet",
+			files: map[string]string{"xl/workbook.xml": `<workbook/>`},
+			err:   "xlsx is missing xl/worksheets/sheet1.xml",
+		},
+		{
+			name: "bad shared string index",
+			files: map[string]string{
+				"xl/sharedStrings.xml":     shared,
+				"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="s"><v>9</v></c></row>`),
+			},
+			err: "cell A1 has an invalid shared string index",
+		},
+		{
+			name: "too many rows",
+			files: map[string]string{
+				"xl/worksheets/sheet1.xml": sheetXML(`<row r="` + strconv.Itoa(maxImportRows+2) + `"><c r="A1"><v>1</v></c></row>`),
+			},
+			err: "sheet has more than " + strconv.Itoa(maxImportRows) + " rows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readXLSXRows(buildXLSX(t, tt.files))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readXLSXRows([]byte("name,email\n")); err == nil || !strings.HasPrefix(err.Error(), "not a valid xlsx file") {
+		t.Errorf("csv data read as xlsx: %v", err)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AA1": 26, "AB9": 27, "1": -1} {
+		if got := xlsxColumn(ref); got != want {
+			t.Errorf("xlsxColumn(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}